@@ -17,19 +17,181 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"strings"
 )
 
+const (
+	// ImageField indexes ImageBackups by spec image
+	ImageField = "spec.image"
+	// ConsumerField indexes ImageBackups by consumer workload key
+	ConsumerField = "spec.consumers"
+
+	imageBackupNamePrefixMaxLength = 46
+	imageBackupNameHashLength      = 16
+)
+
+const (
+	// RefreshPolicyNever reports upstream tag drift without refreshing the backup
+	RefreshPolicyNever = "Never"
+	// RefreshPolicyAlways refreshes the backup whenever upstream tag drift is detected on execution, that is on
+	// ImageBackup creation, recreation or retry. Completed backups are not checked again
+	RefreshPolicyAlways = "Always"
+	// RefreshPolicyScheduled refreshes the backup on drift, checking upstream tag periodically
+	RefreshPolicyScheduled = "Scheduled"
+)
+
+const (
+	// RetentionForever keeps completed ImageBackups
+	RetentionForever = "Forever"
+	// RetentionTTL removes completed ImageBackups once TTL is expired
+	RetentionTTL = "TTL"
+	// RetentionWhileReferenced keeps completed ImageBackups while any workload consumes them, orphaned
+	// ImageBackups are removed once TTL grace period is expired
+	RetentionWhileReferenced = "WhileReferenced"
+)
+
 const (
 	PhasePending = "PENDING"
 	PhaseRunning = "RUNNING"
 	PhaseDone    = "DONE"
+	PhaseFailed  = "FAILED"
 )
 
+// ImageBackup condition types
+const (
+	ConditionSourceResolved    = "SourceResolved"
+	ConditionSignatureVerified = "SignatureVerified"
+	ConditionCopied            = "Copied"
+	ConditionVerified          = "Verified"
+	ConditionReady             = "Ready"
+)
+
+// RetryAnnotation set on a failed ImageBackup retries its execution
+const RetryAnnotation = "image-backup.k8slab.io/retry"
+
+const (
+	// PullSecretInjectionNone disables backup registry pull secret injection
+	PullSecretInjectionNone = "None"
+	// PullSecretInjectionPodTemplate references backup registry pull secret from rewritten pod templates
+	PullSecretInjectionPodTemplate = "PodTemplate"
+	// PullSecretInjectionServiceAccount references backup registry pull secret from rewritten workloads ServiceAccount
+	PullSecretInjectionServiceAccount = "ServiceAccount"
+)
+
+// ManagedByLabel identifies objects managed by the controller, as backup registry pull secrets
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// ManagedBy is the ManagedByLabel value
+const ManagedBy = "image-backup-controller"
+
+// Finalizer cancels in-flight ImageBackup copies on deletion
+const Finalizer = "image-backup.k8slab.io/finalizer"
+
+// WorkloadReference identifies a workload container using the backup image
+type WorkloadReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Container  string `json:"container"`
+}
+
+// Key identifies referenced workload regardless of its container and API version
+func (w WorkloadReference) Key() string {
+	return ConsumerKey(schema.FromAPIVersionAndKind(w.APIVersion, w.Kind).GroupKind(), w.Namespace, w.Name)
+}
+
+// ConsumerKey builds workload consumer key as Kind.group/namespace/name
+func ConsumerKey(gk schema.GroupKind, namespace, name string) string {
+	return gk.String() + "/" + namespace + "/" + name
+}
+
+// Retention defines completed ImageBackups retention policy
+type Retention struct {
+	// +kubebuilder:validation:Enum=Forever;TTL;WhileReferenced
+	Policy string `json:"policy,omitempty"`
+	// TTL is the expiration delay on TTL policy and the orphaned grace period on WhileReferenced policy
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
 // ImageBackupSpec defines the desired state of ImageBackup
 type ImageBackupSpec struct {
+	// Image is the full source image reference
+	Image string `json:"image,omitempty"`
+	// Destination is the backup destination name, empty for the default destination
+	// +optional
+	Destination string `json:"destination,omitempty"`
+	// Replicas are secondary destinations the backup is replicated to, workloads are rewritten once every replica
+	// exists and fail over to the first healthy replica while the primary destination is unhealthy
+	// +optional
+	Replicas []string `json:"replicas,omitempty"`
+	// RefreshPolicy overrides controller refresh policy on upstream tag drift. Always only applies on execution
+	// (creation, recreation or retry), Scheduled checks completed backups again every refresh interval
+	// +kubebuilder:validation:Enum=Never;Always;Scheduled
+	// +optional
+	RefreshPolicy string `json:"refreshPolicy,omitempty"`
+	// Retention overrides controller retention policy
+	// +optional
+	Retention *Retention `json:"retention,omitempty"`
+	// Consumers are the workload containers using the image
+	// +optional
+	Consumers []WorkloadReference `json:"consumers,omitempty"`
+	// SourcePullSecrets are the consumers pull secrets, they authenticate source image pulls only
+	// +optional
+	SourcePullSecrets []corev1.SecretReference `json:"sourcePullSecrets,omitempty"`
+}
+
+// BackupProgress reports image copy progress
+type BackupProgress struct {
+	BytesCopied  int64 `json:"bytesCopied"`
+	BytesTotal   int64 `json:"bytesTotal"`
+	LayersCopied int   `json:"layersCopied"`
+	LayersTotal  int   `json:"layersTotal"`
+	// StartedAt is the copy start timestamp
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+	// ETA is the estimated remaining copy duration
+	ETA string `json:"eta,omitempty"`
+}
+
+// DestinationStatus reports backup state on a destination
+type DestinationStatus struct {
+	// Destination is the destination name, empty for the default destination
+	Destination string `json:"destination"`
+	// Image is the backup image on destination
 	Image string `json:"image,omitempty"`
+	// Digest is the backup image manifest digest on destination
+	Digest string `json:"digest,omitempty"`
+	// Ready reports backup image copied to destination
+	Ready bool `json:"ready"`
+	// Healthy reports destination reachable on last check
+	Healthy bool `json:"healthy"`
+	// Active reports destination used by rewritten workloads
+	Active bool `json:"active,omitempty"`
+	// CopyStarted reports backup image did not exist on destination when this ImageBackup started copying it,
+	// aborted backups only remove those images
+	CopyStarted bool `json:"copyStarted,omitempty"`
+	// LastError is the last destination error
+	LastError string `json:"lastError,omitempty"`
+	// LastCheck is the last destination check timestamp
+	LastCheck *metav1.Time `json:"lastCheck,omitempty"`
+}
+
+// BackupArtifact reports a signature, SBOM or attestation copied alongside backup image
+type BackupArtifact struct {
+	// Kind is one of Signature, Attestation or SBOM
+	Kind string `json:"kind"`
+	// Subject is the backup manifest digest the artifact refers to
+	Subject string `json:"subject"`
+	// Digest is the artifact manifest digest
+	Digest string `json:"digest"`
+	// Reference is the artifact reference on backup registry
+	Reference string `json:"reference,omitempty"`
 }
 
 // ImageBackupStatus defines the observed state of ImageBackup
@@ -37,13 +199,56 @@ type ImageBackupStatus struct {
 	Phase             string           `json:"phase,omitempty"`
 	CreateAt          *metav1.Time     `json:"create_at,omitempty"`
 	ExecutionDuration *metav1.Duration `json:"duration,omitempty"`
+	// Digest is the backup image manifest digest
+	Digest string `json:"digest,omitempty"`
+	// SourceDigest is the source image manifest digest on last resolution
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	// CopiedFrom is the source image manifest digest the backup was copied from, it differs from backup digest
+	// when destination platforms trim source image index
+	CopiedFrom string `json:"copiedFrom,omitempty"`
+	// Drifted reports source image tag pointing to a different manifest than the backup
+	Drifted bool `json:"drifted,omitempty"`
+	// LastDriftCheck is the last source image drift check timestamp
+	LastDriftCheck *metav1.Time `json:"lastDriftCheck,omitempty"`
+	// LastError is the last execution error
+	LastError string `json:"lastError,omitempty"`
+	// Attempts is the number of failed executions
+	Attempts int32 `json:"attempts,omitempty"`
+	// NextRetryAt is the next execution retry timestamp
+	NextRetryAt *metav1.Time `json:"nextRetryAt,omitempty"`
+	// Progress reports last image copy progress
+	Progress *BackupProgress `json:"progress,omitempty"`
+	// Artifacts are the signatures, SBOMs and attestations copied alongside backup image
+	// +optional
+	Artifacts []BackupArtifact `json:"artifacts,omitempty"`
+	// Destinations report backup state on primary and replica destinations, primary first
+	// +optional
+	Destinations []DestinationStatus `json:"destinations,omitempty"`
+	// OrphanedAt is the timestamp since ImageBackup has no consumers
+	OrphanedAt *metav1.Time `json:"orphanedAt,omitempty"`
+	// ObservedGeneration is the last reconciled generation
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions reflect backup execution transitions
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase",description="current status"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason",description="ready condition reason"
 // +kubebuilder:printcolumn:name="CreatedAt",type="string",JSONPath=".status.create_at",description="creation timestamp"
 // +kubebuilder:printcolumn:name="Duration",type="string",JSONPath=".status.duration",description="execution duration"
+// +kubebuilder:printcolumn:name="ETA",type="string",JSONPath=".status.progress.eta",description="estimated remaining copy duration"
+// +kubebuilder:printcolumn:name="Drifted",type="boolean",JSONPath=".status.drifted",description="upstream tag drift"
+// +kubebuilder:printcolumn:name="Attempts",type="integer",JSONPath=".status.attempts",description="failed executions"
+// +kubebuilder:printcolumn:name="Destination",type="string",JSONPath=".spec.destination",description="backup destination",priority=1
+// +kubebuilder:printcolumn:name="Active",type="string",JSONPath=".status.destinations[?(@.active==true)].destination",description="destination used by workloads",priority=1
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.lastError",description="last execution error",priority=1
+// +kubebuilder:printcolumn:name="Copied",type="string",JSONPath=".status.conditions[?(@.type==\"Copied\")].reason",description="copied condition reason",priority=1
+// +kubebuilder:printcolumn:name="Verified",type="string",JSONPath=".status.conditions[?(@.type==\"Verified\")].reason",description="verified condition reason",priority=1
 
 // ImageBackup is the Schema for the imagebackups API
 type ImageBackup struct {
@@ -67,8 +272,52 @@ func init() {
 	SchemeBuilder.Register(&ImageBackup{}, &ImageBackupList{})
 }
 
+// Destinations returns primary destination followed by replicas
+func (ib *ImageBackup) Destinations() []string {
+	return append([]string{ib.Spec.Destination}, ib.Spec.Replicas...)
+}
+
+// ActiveDestination returns the destination used by rewritten workloads, primary destination if none is active
+func (ib *ImageBackup) ActiveDestination() string {
+	for _, d := range ib.Status.Destinations {
+		if d.Active {
+			return d.Destination
+		}
+	}
+
+	return ib.Spec.Destination
+}
+
+// ImageBackupName builds destination ImageBackup name from image reference, default destination names are
+// built from image reference only
+func ImageBackupName(img, destination string) string {
+	if destination == "" {
+		return ImageBackupNameFromImage(img)
+	}
+
+	return ImageBackupNameFromImage(destination + "/" + img)
+}
+
+// ImageBackupNameFromImage builds a DNS subdomain compliant name from image reference, a readable
+// sanitized prefix is suffixed by a 64 bit image hash so that distinct images sharing a name is unlikely
 func ImageBackupNameFromImage(img string) string {
-	img = strings.ReplaceAll(img, "/", "-")
-	img = strings.ReplaceAll(img, ":", "-")
-	return strings.ReplaceAll(img, ".", "-")
+	h := sha256.Sum256([]byte(img))
+	suffix := hex.EncodeToString(h[:])[:imageBackupNameHashLength]
+
+	prefix := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(img))
+	if len(prefix) > imageBackupNamePrefixMaxLength {
+		prefix = prefix[:imageBackupNamePrefixMaxLength]
+	}
+
+	prefix = strings.Trim(prefix, "-")
+	if prefix == "" {
+		return "image-" + suffix
+	}
+
+	return prefix + "-" + suffix
 }
@@ -0,0 +1,43 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation"
+	"strings"
+	"testing"
+)
+
+func TestImageBackupNameFromImageIsValidObjectName(t *testing.T) {
+	images := []string{
+		"nginx:1.14.2",
+		"docker.io/library/nginx:1.21",
+		"nginx@sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c",
+		"Registry.Example.com:5000/Team/App:V1",
+		"registry.example.com/" + strings.Repeat("very-long-repository/", 20) + "app:1.0.0",
+		"_/-:-",
+	}
+
+	for _, img := range images {
+		n := ImageBackupNameFromImage(img)
+		if errs := validation.IsDNS1123Subdomain(n); len(errs) != 0 {
+			t.Errorf("invalid name %s from image %s, errors %v", n, img, errs)
+		}
+	}
+}
+
+func TestImageBackupNameFromImageAvoidsCollisions(t *testing.T) {
+	if ImageBackupNameFromImage("a-b:c") == ImageBackupNameFromImage("a:b-c") {
+		t.Fatal("expected distinct names")
+	}
+}
+
+func TestWorkloadReferenceKeyIgnoresContainerAndVersion(t *testing.T) {
+	a := WorkloadReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "nginx", Name: "nginx", Container: "nginx"}
+	b := WorkloadReference{APIVersion: "apps/v1beta2", Kind: "Deployment", Namespace: "nginx", Name: "nginx", Container: "sidecar"}
+	if a.Key() != b.Key() {
+		t.Fatalf("keys do not match, %s %s", a.Key(), b.Key())
+	}
+
+	if expected, got := "Deployment.apps/nginx/nginx", a.Key(); expected != got {
+		t.Errorf("key does not match, expected %s got %s", expected, got)
+	}
+}
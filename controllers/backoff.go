@@ -0,0 +1,22 @@
+package controllers
+
+import "time"
+
+const defaultMaxRetryBackoff = time.Minute * 5
+
+// retryBackoff returns exponential backoff duration from failed attempts, capped to max
+func retryBackoff(base, max time.Duration, attempts int32) time.Duration {
+	if attempts < 1 {
+		return base
+	}
+
+	d := base
+	for i := int32(1); i < attempts; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+
+	return d
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/executor"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoffGrowsExponentiallyUntilMax(t *testing.T) {
+	var testSamples = []struct {
+		attempts int32
+		expected time.Duration
+	}{
+		{attempts: 0, expected: time.Second * 5},
+		{attempts: 1, expected: time.Second * 5},
+		{attempts: 2, expected: time.Second * 10},
+		{attempts: 4, expected: time.Second * 40},
+		{attempts: 10, expected: time.Minute * 5},
+		{attempts: 100, expected: time.Minute * 5},
+	}
+
+	for _, sample := range testSamples {
+		if expected, got := sample.expected, retryBackoff(time.Second*5, time.Minute*5, sample.attempts); expected != got {
+			t.Errorf("backoff does not match on attempt %d, expected %s got %s", sample.attempts, expected, got)
+		}
+	}
+}
+
+// newRetryReconciler returns a reconciler whose executions fail verifying signatures with err
+func newRetryReconciler(t *testing.T, ib *v1alpha1.ImageBackup, err error) *ImageBackupReconciler {
+	sch := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(sch)
+	e := executor.New(logr.Discard())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go e.Start(ctx)
+
+	return &ImageBackupReconciler{
+		Client:     fake.NewClientBuilder().WithScheme(sch).WithObjects(ib).Build(),
+		Log:        logr.Discard(),
+		Registry:   &fakeImageBackupProvider{},
+		Executor:   e,
+		Resolver:   &fakeImageBackupProvider{},
+		Verifier:   fakeVerifier{err: err},
+		MaxRetries: 3,
+	}
+}
+
+func newFailingImageBackup(phase string, attempts int32, annotations map[string]string) *v1alpha1.ImageBackup {
+	now := metav1.Now()
+	return &v1alpha1.ImageBackup{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "image-backup", Name: "nginx", UID: "uid", Finalizers: []string{v1alpha1.Finalizer}, Annotations: annotations},
+		Spec:       v1alpha1.ImageBackupSpec{Image: "nginx:1.21"},
+		Status:     v1alpha1.ImageBackupStatus{Phase: phase, Attempts: attempts, CreateAt: &now, LastError: "boom"},
+	}
+}
+
+// reconcileExecution reconciles a Running ImageBackup until its execution result is applied
+func reconcileExecution(t *testing.T, r *ImageBackupReconciler, ib *v1alpha1.ImageBackup) *v1alpha1.ImageBackup {
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: ib.Namespace, Name: ib.Name}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for i := 0; ; i++ {
+		if res, ok := r.Executor.Result(string(ib.UID)); ok && res.State == executor.StateDone {
+			break
+		}
+
+		if i == 100 {
+			t.Fatal("backup not executed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res := &v1alpha1.ImageBackup{}
+	if err := r.Get(context.Background(), req.NamespacedName, res); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	return res
+}
+
+func TestFailedExecutionIsRetriedUntilMaxRetries(t *testing.T) {
+	var testSamples = []struct {
+		attempts int32
+		err      error
+		phase    string
+		retry    bool
+	}{
+		{attempts: 0, err: errors.New("registry unavailable"), phase: v1alpha1.PhaseRunning, retry: true},
+		{attempts: 2, err: errors.New("registry unavailable"), phase: v1alpha1.PhaseFailed, retry: false},
+		{attempts: 0, err: fmt.Errorf("%w, unsigned", registry.ErrSignatureNotVerified), phase: v1alpha1.PhaseFailed, retry: false},
+	}
+
+	for i, sample := range testSamples {
+		ib := newFailingImageBackup(v1alpha1.PhaseRunning, sample.attempts, nil)
+		res := reconcileExecution(t, newRetryReconciler(t, ib, sample.err), ib)
+		if expected, got := sample.phase, res.Status.Phase; expected != got {
+			t.Errorf("sample %d phase does not match, expected %s got %s", i, expected, got)
+		}
+
+		if expected, got := sample.attempts+1, res.Status.Attempts; expected != got {
+			t.Errorf("sample %d attempts do not match, expected %d got %d", i, expected, got)
+		}
+
+		if expected, got := sample.retry, res.Status.NextRetryAt != nil; expected != got {
+			t.Errorf("sample %d next retry does not match, expected %t got %t", i, expected, got)
+		}
+
+		if !strings.Contains(res.Status.LastError, sample.err.Error()) {
+			t.Errorf("sample %d unexpected last error %q", i, res.Status.LastError)
+		}
+	}
+}
+
+func TestFailedImageBackupIsRetriedOnAnnotation(t *testing.T) {
+	ib := newFailingImageBackup(v1alpha1.PhaseFailed, 3, nil)
+	r := newRetryReconciler(t, ib, nil)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: ib.Namespace, Name: ib.Name}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res := &v1alpha1.ImageBackup{}
+	if err := r.Get(context.Background(), req.NamespacedName, res); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := v1alpha1.PhaseFailed, res.Status.Phase; expected != got {
+		t.Fatalf("phase does not match without retry annotation, expected %s got %s", expected, got)
+	}
+
+	res.Annotations = map[string]string{v1alpha1.RetryAnnotation: "true"}
+	if err := r.Update(context.Background(), res); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := r.Get(context.Background(), req.NamespacedName, res); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, ok := res.Annotations[v1alpha1.RetryAnnotation]; ok {
+		t.Error("expected retry annotation removal")
+	}
+
+	if expected, got := v1alpha1.PhasePending, res.Status.Phase; expected != got {
+		t.Errorf("phase does not match, expected %s got %s", expected, got)
+	}
+
+	if res.Status.Attempts != 0 || res.Status.NextRetryAt != nil {
+		t.Errorf("expected retry status reset, got attempts %d next retry %v", res.Status.Attempts, res.Status.NextRetryAt)
+	}
+}
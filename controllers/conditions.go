@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ImageBackup condition reasons
+const (
+	reasonResolved         = "Resolved"
+	reasonResolutionFailed = "ResolutionFailed"
+	reasonQueued           = "Queued"
+	reasonCopied           = "Copied"
+	reasonAlreadyExists    = "AlreadyExists"
+	reasonCopyFailed       = "CopyFailed"
+	reasonDigestRecorded   = "DigestRecorded"
+	reasonDigestMismatch   = "DigestMismatch"
+	reasonVerifyFailed     = "VerificationFailed"
+	reasonPending          = "Pending"
+	reasonRunning          = "Running"
+	reasonRetrying         = "Retrying"
+	reasonFailed           = "Failed"
+	reasonReady            = "BackupReady"
+
+	reasonSignatureVerified    = "SignatureVerified"
+	reasonSignatureNotVerified = "SignatureNotVerified"
+)
+
+func setCondition(ib *v1alpha1.ImageBackup, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ib.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: ib.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// setReadyCondition reflects ImageBackup phase on Ready condition
+func setReadyCondition(ib *v1alpha1.ImageBackup) {
+	switch ib.Status.Phase {
+	case v1alpha1.PhaseDone:
+		setCondition(ib, v1alpha1.ConditionReady, metav1.ConditionTrue, reasonReady, "backup image is available")
+	case v1alpha1.PhaseFailed:
+		reason := reasonFailed
+		if meta.IsStatusConditionFalse(ib.Status.Conditions, v1alpha1.ConditionSignatureVerified) {
+			reason = reasonSignatureNotVerified
+		}
+		setCondition(ib, v1alpha1.ConditionReady, metav1.ConditionFalse, reason, ib.Status.LastError)
+	case v1alpha1.PhaseRunning:
+		if ib.Status.LastError != "" {
+			setCondition(ib, v1alpha1.ConditionReady, metav1.ConditionFalse, reasonRetrying, ib.Status.LastError)
+			return
+		}
+		setCondition(ib, v1alpha1.ConditionReady, metav1.ConditionFalse, reasonRunning, "backup in progress")
+	default:
+		setCondition(ib, v1alpha1.ConditionReady, metav1.ConditionFalse, reasonPending, "backup pending")
+	}
+}
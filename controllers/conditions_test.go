@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestReadyConditionReflectsPhase(t *testing.T) {
+	var testSamples = []struct {
+		phase     string
+		lastError string
+		status    metav1.ConditionStatus
+		reason    string
+	}{
+		{phase: v1alpha1.PhasePending, status: metav1.ConditionFalse, reason: reasonPending},
+		{phase: v1alpha1.PhaseRunning, status: metav1.ConditionFalse, reason: reasonRunning},
+		{phase: v1alpha1.PhaseRunning, lastError: "foo", status: metav1.ConditionFalse, reason: reasonRetrying},
+		{phase: v1alpha1.PhaseFailed, lastError: "foo", status: metav1.ConditionFalse, reason: reasonFailed},
+		{phase: v1alpha1.PhaseDone, status: metav1.ConditionTrue, reason: reasonReady},
+	}
+
+	for _, sample := range testSamples {
+		ib := &v1alpha1.ImageBackup{
+			ObjectMeta: metav1.ObjectMeta{Generation: 2},
+			Status: v1alpha1.ImageBackupStatus{
+				Phase:     sample.phase,
+				LastError: sample.lastError,
+			},
+		}
+		setReadyCondition(ib)
+
+		c := meta.FindStatusCondition(ib.Status.Conditions, v1alpha1.ConditionReady)
+		if c == nil {
+			t.Fatalf("ready condition not found on phase %s", sample.phase)
+		}
+
+		if c.Status != sample.status || c.Reason != sample.reason {
+			t.Errorf("condition does not match on phase %s, expected %s/%s got %s/%s", sample.phase, sample.status, sample.reason, c.Status, c.Reason)
+		}
+
+		if c.ObservedGeneration != 2 {
+			t.Errorf("unexpected observed generation %d", c.ObservedGeneration)
+		}
+	}
+}
+
+type fakeVerifier struct {
+	err error
+}
+
+func (f fakeVerifier) Verify(ctx context.Context, image, digest string) error {
+	return f.err
+}
+
+func TestUnverifiedSignatureFailsBackupWithoutRetries(t *testing.T) {
+	r := &ImageBackupReconciler{
+		Log:      logr.Discard(),
+		Verifier: fakeVerifier{err: fmt.Errorf("%w, no signatures found", registry.ErrSignatureNotVerified)},
+	}
+	ib := &v1alpha1.ImageBackup{
+		Spec:   v1alpha1.ImageBackupSpec{Image: "nginx:1.14.2"},
+		Status: v1alpha1.ImageBackupStatus{Phase: v1alpha1.PhaseRunning},
+	}
+
+	err := r.verifySignature(context.Background(), ib, "sha256:foo")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	r.failed(ib, err)
+	setReadyCondition(ib)
+	if expected, got := v1alpha1.PhaseFailed, ib.Status.Phase; expected != got {
+		t.Errorf("phase does not match, expected %s got %s", expected, got)
+	}
+
+	if c := meta.FindStatusCondition(ib.Status.Conditions, v1alpha1.ConditionSignatureVerified); c == nil || c.Reason != reasonSignatureNotVerified {
+		t.Errorf("unexpected signature verified condition %+v", c)
+	}
+
+	if c := meta.FindStatusCondition(ib.Status.Conditions, v1alpha1.ConditionReady); c == nil || c.Reason != reasonSignatureNotVerified {
+		t.Errorf("unexpected ready condition %+v", c)
+	}
+
+	r.Verifier = fakeVerifier{}
+	if err := r.verifySignature(context.Background(), ib, "sha256:foo"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !meta.IsStatusConditionTrue(ib.Status.Conditions, v1alpha1.ConditionSignatureVerified) {
+		t.Error("expected signature verified condition")
+	}
+}
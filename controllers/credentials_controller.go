@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"time"
+)
+
+const defaultTokenFileInterval = 30 * time.Second
+
+// CredentialsReconciler watches backup registry credentials Secret, credentials are swapped on change
+type CredentialsReconciler struct {
+	// Name identifies the controller when several credentials Secrets are watched
+	Name string
+	// Reader reads credentials Secret, usually a cache restricted to it
+	Reader         client.Reader
+	Log            logr.Logger
+	Secret         types.NamespacedName
+	BackupRegistry string
+	Credentials    *registry.Credentials
+	// OnRotate is called once credentials have been swapped
+	OnRotate func(ctx context.Context) error
+}
+
+// Reconcile swaps backup registry credentials from Secret
+func (r *CredentialsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.NamespacedName != r.Secret {
+		return ctrl.Result{}, nil
+	}
+
+	s := &corev1.Secret{}
+	if err := r.Reader.Get(ctx, req.NamespacedName, s); err != nil {
+		if errors.IsNotFound(err) {
+			// last known credentials are kept
+			r.Log.Info("Backup registry credentials secret not found", "resource", req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, fmt.Errorf("unable to get credentials secret %s, error %w", req.NamespacedName, err)
+	}
+
+	auth, err := registry.AuthenticatorFromSecret(s, r.BackupRegistry)
+	if err != nil {
+		r.Log.Error(err, "invalid backup registry credentials secret", "resource", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	changed, err := r.Credentials.Set(auth)
+	if err != nil {
+		r.Log.Error(err, "unable to swap backup registry credentials", "resource", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	if !changed {
+		return ctrl.Result{}, nil
+	}
+
+	r.Log.Info("Backup registry credentials rotated", "resource", req.NamespacedName)
+	if r.OnRotate == nil {
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, r.OnRotate(ctx)
+}
+
+// SetupWithManager sets up the controller with the Manager, credentials Secret is watched from secretCache
+func (r *CredentialsReconciler) SetupWithManager(mgr ctrl.Manager, secretCache cache.Cache) error {
+	secret := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetNamespace() == r.Secret.Namespace && o.GetName() == r.Secret.Name
+	})
+
+	name := "credentials"
+	if r.Name != "" {
+		name += "-" + r.Name
+	}
+
+	c, err := controller.New(name, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(source.NewKindWithCache(&corev1.Secret{}, secretCache), &handler.EnqueueRequestForObject{}, secret)
+}
+
+// TokenFileWatcher checks backup registry credentials read from a token file, OnRotate is called once the file
+// token changes as credentials Secret rotations do
+type TokenFileWatcher struct {
+	Log         logr.Logger
+	Credentials authn.Authenticator
+	// Interval is the token file check period, 30 seconds if empty
+	Interval time.Duration
+	// OnRotate is called once token has been rotated
+	OnRotate func(ctx context.Context) error
+
+	last *authn.AuthConfig
+}
+
+// Start checks token file until context is done
+func (w *TokenFileWatcher) Start(ctx context.Context) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = defaultTokenFileInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.check(ctx)
+		}
+	}
+}
+
+// check calls OnRotate if token has changed since last check, unreadable token files keep last known token
+func (w *TokenFileWatcher) check(ctx context.Context) {
+	next, err := w.Credentials.Authorization()
+	if err != nil {
+		w.Log.Error(err, "unable to read backup registry token file")
+		return
+	}
+
+	prev := w.last
+	w.last = next
+	if prev == nil || *prev == *next {
+		return
+	}
+
+	w.Log.Info("Backup registry token rotated")
+	if w.OnRotate == nil {
+		return
+	}
+
+	if err := w.OnRotate(ctx); err != nil {
+		w.Log.Error(err, "unable to resync backup registry token rotation")
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"os"
+	"path/filepath"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func TestCredentialsReconcilerRotatesCredentialsFromSecret(t *testing.T) {
+	key := types.NamespacedName{Namespace: "image-backup", Name: "backup-registry-secret"}
+	s := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Type:       corev1.SecretTypeBasicAuth,
+		Data:       map[string][]byte{corev1.BasicAuthUsernameKey: []byte("user"), corev1.BasicAuthPasswordKey: []byte("rotated")},
+	}
+
+	rotations := 0
+	credentials := registry.NewCredentials(authn.FromConfig(authn.AuthConfig{Username: "user", Password: "initial"}))
+	r := &CredentialsReconciler{
+		Reader:         fake.NewClientBuilder().WithObjects(s).Build(),
+		Log:            logr.Discard(),
+		Secret:         key,
+		BackupRegistry: "docker.io/backupregistry/",
+		Credentials:    credentials,
+		OnRotate: func(ctx context.Context) error {
+			rotations++
+			return nil
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	cfg, _ := credentials.Authorization()
+	if expected, got := "rotated", cfg.Password; expected != got {
+		t.Errorf("password does not match, expected %s got %s", expected, got)
+	}
+
+	if expected, got := 1, rotations; expected != got {
+		t.Errorf("rotations do not match, expected %d got %d", expected, got)
+	}
+}
+
+func TestTokenFileWatcherResyncsOnTokenRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("initial"), 0600); err != nil {
+		t.Fatalf("unable to write token file, error %v", err)
+	}
+
+	resyncs := 0
+	w := &TokenFileWatcher{
+		Log:         logr.Discard(),
+		Credentials: registry.NewCredentials(registry.NewTokenFileAuthenticator(path)),
+		OnRotate: func(ctx context.Context) error {
+			resyncs++
+			return nil
+		},
+	}
+
+	w.check(context.Background())
+	w.check(context.Background())
+	if resyncs != 0 {
+		t.Fatalf("unexpected resyncs %d", resyncs)
+	}
+
+	if err := os.WriteFile(path, []byte("rotated"), 0600); err != nil {
+		t.Fatalf("unable to write token file, error %v", err)
+	}
+	// token file is read again once its modification time changes
+	next := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, next, next); err != nil {
+		t.Fatalf("unable to touch token file, error %v", err)
+	}
+
+	w.check(context.Background())
+	w.check(context.Background())
+	if expected, got := 1, resyncs; expected != got {
+		t.Errorf("resyncs do not match, expected %d got %d", expected, got)
+	}
+}
@@ -19,12 +19,15 @@ package controllers
 import (
 	"context"
 	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // DaemonSetReconciler reconciles a DaemonSet object
@@ -36,25 +39,26 @@ type DaemonSetReconciler struct {
 }
 
 //+kubebuilder:rbac:groups="";apps,resources=daemonsets,verbs=get;update;list;watch
-//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=create;get;list
+//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=create;get;list;update;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *DaemonSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	dms := &appsv1.DaemonSet{}
-	return r.reconcile(ctx, req, dms)
+	return r.reconcile(ctx, req, dms, DaemonSetPodTemplate)
 }
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *DaemonSetReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, banNs []string) error {
+func (r *DaemonSetReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, ns *NamespaceSelector) error {
 	pr := predicate.And(
-		IgnoreDeleteEvents(),
 		IgnoreGenericEvents(),
-		IgnoreRestrictedNamespaces(banNs),
+		SelectedNamespaces(ns),
 		DaemonSetReady(),
 		DaemonSetHasNonBackupImage(fn.IsNonImageBackup),
 	)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appsv1.DaemonSet{}, builder.WithPredicates(pr)).
+		Watches(&source.Kind{Type: &v1alpha1.ImageBackup{}}, failoverRequests(appsv1.SchemeGroupVersion.WithKind("DaemonSet").GroupKind()), builder.WithPredicates(ActiveDestinationChanged())).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, namespaceRequests(r.Client, ns, func() client.ObjectList { return &appsv1.DaemonSetList{} }, pr), builder.WithPredicates(NamespaceLabelsChanged())).
 		Complete(r)
 }
@@ -19,12 +19,15 @@ package controllers
 import (
 	"context"
 	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // DeploymentReconciler reconciles a Deployment object
@@ -36,26 +39,27 @@ type DeploymentReconciler struct {
 }
 
 //+kubebuilder:rbac:groups="";apps,resources=deployments,verbs=get;list;update;watch
-//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=create;get;list
+//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=create;get;list;update;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	dpl := &appsv1.Deployment{}
-	return r.reconcile(ctx, req, dpl)
+	return r.reconcile(ctx, req, dpl, DeploymentPodTemplate)
 }
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, banNs []string) error {
+func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, ns *NamespaceSelector) error {
 	pr := predicate.And(
-		IgnoreDeleteEvents(),
 		IgnoreGenericEvents(),
-		IgnoreRestrictedNamespaces(banNs),
+		SelectedNamespaces(ns),
 		DeploymentReady(),
 		DeploymentHasNonBackupImage(fn.IsNonImageBackup),
 	)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appsv1.Deployment{}, builder.WithPredicates(pr)).
+		Watches(&source.Kind{Type: &v1alpha1.ImageBackup{}}, failoverRequests(appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind()), builder.WithPredicates(ActiveDestinationChanged())).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, namespaceRequests(r.Client, ns, func() client.ObjectList { return &appsv1.DeploymentList{} }, pr), builder.WithPredicates(NamespaceLabelsChanged())).
 		Complete(r)
 }
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// destinationRegistry returns backup destination registry, non routed registries only serve default destination
+func destinationRegistry(reg registry.DockerRegistry, destination string) (registry.DockerRegistry, error) {
+	router, ok := reg.(registry.Router)
+	if !ok {
+		if destination != registry.DefaultDestination {
+			return nil, fmt.Errorf("backup destination %s not found", destination)
+		}
+
+		return reg, nil
+	}
+
+	d, ok := router.Destination(destination)
+	if !ok {
+		return nil, fmt.Errorf("backup destination %s not found", destination)
+	}
+
+	return d, nil
+}
+
+// backupImageName formats ImageBackup image name on its destination
+func backupImageName(reg registry.DockerRegistry, ib *v1alpha1.ImageBackup) (string, error) {
+	return destinationImageName(reg, ib.Spec.Destination, ib.Spec.Image)
+}
+
+// destinationImageName formats image backup name on destination
+func destinationImageName(reg registry.DockerRegistry, destination, image string) (string, error) {
+	d, err := destinationRegistry(reg, destination)
+	if err != nil {
+		return "", err
+	}
+
+	return d.BackupImageName(image)
+}
+
+// pullable reports if workloads can pull destination backup images
+func (r *GenericReconciler) pullable(destination string) bool {
+	d, err := destinationRegistry(r.Registry, destination)
+	return err == nil && registry.Pullable(d)
+}
+
+// route selects workload image backup destination, namespace labels are only fetched if routes match them
+func (r *GenericReconciler) route(ctx context.Context, ns, image string) (string, error) {
+	router, ok := r.Registry.(registry.Router)
+	if !ok {
+		return registry.DefaultDestination, nil
+	}
+
+	var labels map[string]string
+	if router.NamespaceLabelsRequired() {
+		n := &corev1.Namespace{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ns}, n); err != nil {
+			return "", fmt.Errorf("unable to get namespace %s, error %w", ns, err)
+		}
+		labels = n.Labels
+	}
+
+	return router.Route(ns, labels, image), nil
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
+	"testing"
+)
+
+func TestRouteMatchesNamespaceLabels(t *testing.T) {
+	def := registry.NewDockerRegistry("docker.io/backupregistry/", "foo", "bar")
+	eu := registry.NewDockerRegistry("eu.gcr.io/backup/", "foo", "bar")
+	router, err := registry.NewRouter(def, map[string]registry.DockerRegistry{"eu": eu}, []registry.Route{
+		{Destination: "eu", NamespaceSelector: labels.SelectorFromSet(labels.Set{"region": "eu"})},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"region": "eu"}}}
+	r := &GenericReconciler{Client: fake.NewClientBuilder().WithObjects(ns).Build(), Registry: router}
+
+	dst, err := r.route(context.Background(), "team-a", "nginx:1.14.2")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := "eu", dst; expected != got {
+		t.Fatalf("destination does not match, expected %s got %s", expected, got)
+	}
+
+	ib := newImageBackup(imageBackupNamespace, v1alpha1.ImageBackupName("nginx:1.14.2", dst), "nginx:1.14.2", dst, v1alpha1.WorkloadReference{}, nil)
+	newImage, err := backupImageName(r.Registry, ib)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !strings.HasPrefix(newImage, "eu.gcr.io/backup/") {
+		t.Errorf("backup image does not match destination, got %s", newImage)
+	}
+
+	if ib.Name == v1alpha1.ImageBackupNameFromImage("nginx:1.14.2") {
+		t.Error("expected destination ImageBackup name to differ from default destination one")
+	}
+}
+
+func TestDestinationRegistryRejectsUnknownDestination(t *testing.T) {
+	if _, err := destinationRegistry(&fakeImageBackupProvider{}, "eu"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := destinationRegistry(&fakeImageBackupProvider{}, registry.DefaultDestination); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestLocalDestinationsAreNotPullable(t *testing.T) {
+	def := registry.NewDockerRegistry("docker.io/backupregistry/", "foo", "bar")
+	edge, err := registry.NewLocalRegistry(registry.DefaultLocalRepository+"edge/", t.TempDir(), registry.LocalFormatOCILayout)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	router, err := registry.NewRouter(def, map[string]registry.DockerRegistry{"edge": edge}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	r := &GenericReconciler{Registry: router}
+	if !r.pullable(registry.DefaultDestination) {
+		t.Error("expected pullable default destination")
+	}
+
+	if r.pullable("edge") {
+		t.Error("expected non pullable local destination")
+	}
+}
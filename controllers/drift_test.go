@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func pushRandomImage(t *testing.T, image string) string {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	if err := crane.Push(img, image); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	return digest.String()
+}
+
+func TestUpstreamTagDriftRefreshesBackup(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := u.Host + "/source/nginx:1.21"
+	first := pushRandomImage(t, src)
+
+	r := &ImageBackupReconciler{Log: logr.Discard(), Registry: registry.NewDockerRegistry(u.Host+"/backup/", "foo", "bar")}
+	ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: src}}
+	if _, err := r.execute(context.Background(), ib, func(*v1alpha1.BackupProgress) {}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	moved := pushRandomImage(t, src)
+	checkedAt := time.Now().Add(-time.Second)
+	refresh, err := r.refreshOnDrift(context.Background(), ib)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Never refresh policy only reports drift
+	if refresh {
+		t.Error("unexpected refresh on Never refresh policy")
+	}
+
+	if !ib.Status.Drifted {
+		t.Error("expected drifted backup")
+	}
+
+	if expected, got := moved, ib.Status.SourceDigest; expected != got {
+		t.Errorf("source digest does not match, expected %s got %s", expected, got)
+	}
+
+	if expected, got := first, ib.Status.CopiedFrom; expected != got {
+		t.Errorf("copied from does not match, expected %s got %s", expected, got)
+	}
+
+	if ib.Status.LastDriftCheck == nil || ib.Status.LastDriftCheck.Time.Before(checkedAt) {
+		t.Errorf("unexpected last drift check %v", ib.Status.LastDriftCheck)
+	}
+
+	ib.Spec.RefreshPolicy = v1alpha1.RefreshPolicyAlways
+	refresh, err = r.refreshOnDrift(context.Background(), ib)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !refresh {
+		t.Fatal("expected refresh on Always refresh policy")
+	}
+
+	// execution copies the backup again from the moved tag
+	digest, err := r.execute(context.Background(), ib, func(*v1alpha1.BackupProgress) {})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := moved, digest; expected != got {
+		t.Errorf("refreshed backup digest does not match, expected %s got %s", expected, got)
+	}
+
+	if expected, got := moved, ib.Status.CopiedFrom; expected != got {
+		t.Errorf("copied from does not match, expected %s got %s", expected, got)
+	}
+
+	if ib.Status.Drifted {
+		t.Error("unexpected drifted refreshed backup")
+	}
+}
+
+func TestPlatformFilteredBackupsDoNotDrift(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := u.Host + "/source/nginx:1.21"
+	var idx v1.ImageIndex = empty.Index
+	for _, platform := range []string{"linux/amd64", "linux/arm64"} {
+		img, err := random.Image(512, 1)
+		if err != nil {
+			t.Fatalf("unable to create image, error %v", err)
+		}
+
+		p, _ := v1.ParsePlatform(platform)
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: p}})
+	}
+
+	ref, _ := name.ParseReference(src)
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatalf("unable to push index, error %v", err)
+	}
+
+	platforms, _ := registry.ParsePlatforms([]string{"linux/amd64"})
+	r := &ImageBackupReconciler{
+		Log:           logr.Discard(),
+		Registry:      registry.NewDockerRegistry(u.Host+"/backup/", "foo", "bar", registry.WithPlatforms(platforms...)),
+		RefreshPolicy: v1alpha1.RefreshPolicyAlways,
+	}
+	ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: src}}
+	digest, err := r.execute(context.Background(), ib, func(*v1alpha1.BackupProgress) {})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if digest == ib.Status.CopiedFrom {
+		t.Fatal("expected trimmed index digest")
+	}
+
+	var testSamples = []struct {
+		name       string
+		copiedFrom string
+	}{
+		{name: "copied source digest", copiedFrom: ib.Status.CopiedFrom},
+		{name: "unknown copied source digest", copiedFrom: ""},
+	}
+
+	for _, sample := range testSamples {
+		ib.Status.CopiedFrom = sample.copiedFrom
+		refresh, err := r.refreshOnDrift(context.Background(), ib)
+		if err != nil {
+			t.Fatalf("unexpected error on %s %v", sample.name, err)
+		}
+
+		if refresh || ib.Status.Drifted {
+			t.Errorf("unexpected drift on %s", sample.name)
+		}
+
+		if expected, got := ib.Status.SourceDigest, ib.Status.CopiedFrom; expected != got {
+			t.Errorf("copied from does not match on %s, expected %s got %s", sample.name, expected, got)
+		}
+	}
+}
+
+func TestNextDriftCheck(t *testing.T) {
+	recent := metav1.NewTime(time.Now().Add(-time.Minute))
+	old := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+
+	var testSamples = []struct {
+		policy    string
+		interval  time.Duration
+		lastCheck *metav1.Time
+		due       bool
+		pending   bool
+	}{
+		{policy: v1alpha1.RefreshPolicyNever, interval: time.Hour, lastCheck: nil, due: false},
+		{policy: v1alpha1.RefreshPolicyAlways, interval: time.Hour, lastCheck: nil, due: false},
+		{policy: v1alpha1.RefreshPolicyScheduled, interval: 0, lastCheck: nil, due: false},
+		{policy: v1alpha1.RefreshPolicyScheduled, interval: time.Hour, lastCheck: nil, due: true},
+		{policy: v1alpha1.RefreshPolicyScheduled, interval: time.Hour, lastCheck: &recent, due: false, pending: true},
+		{policy: v1alpha1.RefreshPolicyScheduled, interval: time.Hour, lastCheck: &old, due: true},
+	}
+
+	for i, sample := range testSamples {
+		r := &ImageBackupReconciler{RefreshPolicy: sample.policy, RefreshInterval: sample.interval}
+		ib := &v1alpha1.ImageBackup{Status: v1alpha1.ImageBackupStatus{LastDriftCheck: sample.lastCheck}}
+		next, due := r.nextDriftCheck(ib)
+		if expected, got := sample.due, due; expected != got {
+			t.Errorf("sample %d due does not match, expected %t got %t", i, expected, got)
+		}
+
+		if !sample.pending {
+			continue
+		}
+
+		if next <= 58*time.Minute || next > 59*time.Minute {
+			t.Errorf("sample %d unexpected next drift check %v", i, next)
+		}
+	}
+}
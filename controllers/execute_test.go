@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestExecuteBacksUpToLocalStores(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := u.Host + "/source/nginx:1.21"
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	if err := crane.Push(img, src); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	srcDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, format := range []string{registry.LocalFormatOCILayout, registry.LocalFormatTarball} {
+		local, err := registry.NewLocalRegistry(registry.DefaultLocalRepository, t.TempDir(), format)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		r := &ImageBackupReconciler{Log: logr.Discard(), Registry: local}
+		ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: src}}
+		if _, err := r.execute(context.Background(), ib, func(*v1alpha1.BackupProgress) {}); err != nil {
+			t.Fatalf("unexpected error on %s store %v", format, err)
+		}
+
+		if !meta.IsStatusConditionTrue(ib.Status.Conditions, v1alpha1.ConditionSourceResolved) {
+			t.Errorf("expected source resolved condition on %s store", format)
+		}
+
+		if expected, got := srcDigest.String(), ib.Status.SourceDigest; expected != got {
+			t.Errorf("source digest does not match on %s store, expected %s got %s", format, expected, got)
+		}
+
+		if !destinationStatus(ib, "").CopyStarted {
+			t.Errorf("expected copy started on %s store", format)
+		}
+
+		// recreated ImageBackups find the existing backup image, it is never owned by them
+		recreated := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: src}, Status: v1alpha1.ImageBackupStatus{Phase: v1alpha1.PhaseRunning}}
+		if _, err := r.execute(context.Background(), recreated, func(*v1alpha1.BackupProgress) {}); err != nil {
+			t.Fatalf("unexpected error on %s store %v", format, err)
+		}
+
+		if destinationStatus(recreated, "").CopyStarted || aborted(recreated) {
+			t.Errorf("unexpected copy started on existing %s store backup", format)
+		}
+
+		// drift checks resolve source digests the same way
+		refresh, err := r.refreshOnDrift(context.Background(), ib)
+		if err != nil {
+			t.Fatalf("unexpected drift check error on %s store %v", format, err)
+		}
+
+		if refresh || ib.Status.Drifted {
+			t.Errorf("unexpected drift on %s store", format)
+		}
+	}
+}
+
+type verifierFunc func(ctx context.Context, image, digest string) error
+
+func (f verifierFunc) Verify(ctx context.Context, image, digest string) error {
+	return f(ctx, image, digest)
+}
+
+func TestExecuteCopiesVerifiedDigestWhenTagMoves(t *testing.T) {
+	s := httptest.NewServer(ggcrregistry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := u.Host + "/source/nginx:1.21"
+	verified, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	if err := crane.Push(verified, src); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	verifiedDigest, err := verified.Digest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	r := &ImageBackupReconciler{
+		Log:      logr.Discard(),
+		Registry: registry.NewDockerRegistry(u.Host+"/backup/", "foo", "bar"),
+		// upstream tag moves once signature is verified
+		Verifier: verifierFunc(func(ctx context.Context, image, digest string) error {
+			unverified, err := random.Image(1024, 2)
+			if err != nil {
+				return err
+			}
+
+			return crane.Push(unverified, src)
+		}),
+	}
+	ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: src}}
+	digest, err := r.execute(context.Background(), ib, func(*v1alpha1.BackupProgress) {})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := verifiedDigest.String(), digest; expected != got {
+		t.Errorf("backup digest does not match verified digest, expected %s got %s", expected, got)
+	}
+
+	if expected, got := verifiedDigest.String(), ib.Status.CopiedFrom; expected != got {
+		t.Errorf("copied from does not match, expected %s got %s", expected, got)
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/executor"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"time"
+)
+
+// finalize cancels in-flight copy, once stopped the aborted backup destination is optionally removed and
+// the finalizer released
+func (r *ImageBackupReconciler) finalize(ctx context.Context, ib *v1alpha1.ImageBackup) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(ib, v1alpha1.Finalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	key := string(ib.UID)
+	if r.Executor.Cancel(key) {
+		r.Log.Info("Cancelling image backup on deletion", "key", ib.Name)
+	}
+
+	res, ok := r.Executor.Result(key)
+	if ok && res.State != executor.StateDone {
+		// cancelled copy is stopping, completion is notified by executor
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+
+	if out, _ := res.Value.(*backupResult); out != nil {
+		// stopped execution status reports the copies it started, copies completed before cancellation are kept
+		out.apply(ib)
+		if out.digest != "" {
+			ib.Status.Digest = out.digest
+		}
+	}
+	r.Executor.Forget(key)
+
+	if r.CleanupAborted && aborted(ib) {
+		if err := r.cleanup(ctx, ib); err != nil {
+			r.Log.Error(err, "unable to remove aborted backup image", "key", ib.Name)
+		}
+	}
+
+	controllerutil.RemoveFinalizer(ib, v1alpha1.Finalizer)
+	return r.update(ctx, ib)
+}
+
+// aborted reports if ImageBackup copy never completed after starting a copy of a missing backup image, existing
+// backup images are never removed since other ImageBackups or workloads may use them
+func aborted(ib *v1alpha1.ImageBackup) bool {
+	if ib.Status.Phase != v1alpha1.PhaseRunning && ib.Status.Phase != v1alpha1.PhaseFailed {
+		return false
+	}
+
+	if ib.Status.Digest != "" {
+		return false
+	}
+
+	for _, d := range ib.Status.Destinations {
+		if d.CopyStarted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cleanup removes backup destination tags pushed by aborted ImageBackup on primary and replica destinations
+func (r *ImageBackupReconciler) cleanup(ctx context.Context, ib *v1alpha1.ImageBackup) error {
+	for _, destination := range ib.Destinations() {
+		if !destinationStatus(ib, destination).CopyStarted {
+			continue
+		}
+
+		if err := r.cleanupDestination(ctx, ib, destination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ImageBackupReconciler) cleanupDestination(ctx context.Context, ib *v1alpha1.ImageBackup, destination string) error {
+	reg, err := destinationRegistry(r.Registry, destination)
+	if err != nil {
+		return err
+	}
+
+	newImage, err := reg.BackupImageName(ib.Spec.Image)
+	if err != nil {
+		return fmt.Errorf("unable to build image  %s new name, error %w", ib.Spec.Image, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	defer cancel()
+	exists, err := reg.Exists(ctx, newImage)
+	if err != nil || !exists {
+		return err
+	}
+
+	r.Log.Info("Removing aborted backup image", "key", ib.Name, "image", newImage)
+	return reg.Delete(ctx, newImage)
+}
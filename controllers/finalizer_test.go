@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/executor"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"net/http/httptest"
+	"net/url"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+	"time"
+)
+
+func TestAbortedBackupsOnlyIncludeStartedCopies(t *testing.T) {
+	var testSamples = []struct {
+		phase       string
+		digest      string
+		copyStarted bool
+		expected    bool
+	}{
+		{phase: v1alpha1.PhasePending, expected: false},
+		{phase: v1alpha1.PhasePending, copyStarted: true, expected: false},
+		// recreated ImageBackups deleted before its copy runs never own the existing backup image
+		{phase: v1alpha1.PhaseRunning, expected: false},
+		{phase: v1alpha1.PhaseRunning, copyStarted: true, expected: true},
+		{phase: v1alpha1.PhaseFailed, expected: false},
+		{phase: v1alpha1.PhaseFailed, copyStarted: true, expected: true},
+		{phase: v1alpha1.PhaseRunning, digest: "sha256:foo", copyStarted: true, expected: false},
+		{phase: v1alpha1.PhaseDone, digest: "sha256:foo", copyStarted: true, expected: false},
+	}
+
+	for _, sample := range testSamples {
+		ib := &v1alpha1.ImageBackup{Status: v1alpha1.ImageBackupStatus{Phase: sample.phase, Digest: sample.digest}}
+		if sample.copyStarted {
+			recordDestination(ib, v1alpha1.DestinationStatus{CopyStarted: true})
+		}
+
+		if expected, got := sample.expected, aborted(ib); expected != got {
+			t.Errorf("aborted does not match on phase %s copy started %t, expected %t got %t", sample.phase, sample.copyStarted, expected, got)
+		}
+	}
+}
+
+func TestRecordDestinationKeepsCopyStarted(t *testing.T) {
+	ib := &v1alpha1.ImageBackup{}
+	recordDestination(ib, v1alpha1.DestinationStatus{Image: "foo", CopyStarted: true})
+	recordDestination(ib, v1alpha1.DestinationStatus{Image: "foo", Digest: "sha256:foo", Ready: true, Healthy: true})
+
+	if !destinationStatus(ib, "").CopyStarted {
+		t.Error("expected copy started destination")
+	}
+}
+
+func TestFinalizeRemovesTagPushedByCancelledCopy(t *testing.T) {
+	var testSamples = []struct {
+		name      string
+		completed bool
+		exists    bool
+	}{
+		{name: "cancelled copy", completed: false, exists: false},
+		// copy completes between cancellation and result release
+		{name: "completed copy", completed: true, exists: true},
+	}
+
+	for _, sample := range testSamples {
+		s := httptest.NewServer(ggcrregistry.New())
+		u, _ := url.Parse(s.URL)
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatalf("unable to create random image, error %v", err)
+		}
+
+		sch := runtime.NewScheme()
+		_ = v1alpha1.AddToScheme(sch)
+		e := executor.New(logr.Discard())
+		ctx, cancel := context.WithCancel(context.Background())
+		go e.Start(ctx)
+
+		reg := registry.NewDockerRegistry(u.Host+"/backup/", "foo", "bar")
+		r := &ImageBackupReconciler{
+			Client:         fake.NewClientBuilder().WithScheme(sch).Build(),
+			Log:            logr.Discard(),
+			Registry:       reg,
+			Executor:       e,
+			CleanupAborted: true,
+		}
+		ib := &v1alpha1.ImageBackup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "image-backup", Name: "nginx", UID: "uid", Finalizers: []string{v1alpha1.Finalizer}},
+			Spec:       v1alpha1.ImageBackupSpec{Image: "nginx:1.21"},
+			Status:     v1alpha1.ImageBackupStatus{Phase: v1alpha1.PhaseRunning},
+		}
+		newImage, _ := backupImageName(reg, ib)
+
+		// running copy pushes a missing backup image, it completes or is cancelled before completion
+		started := make(chan struct{})
+		err = e.Submit(executor.Job{
+			Key: string(ib.UID),
+			Run: func(ctx context.Context, report executor.ReportFunc) (interface{}, error) {
+				work := ib.DeepCopy()
+				recordDestination(work, v1alpha1.DestinationStatus{Image: newImage, CopyStarted: true})
+				if err := crane.Push(img, newImage); err != nil {
+					return nil, err
+				}
+				close(started)
+				if sample.completed {
+					d, _ := img.Digest()
+					return &backupResult{digest: d.String(), status: work.Status}, nil
+				}
+
+				<-ctx.Done()
+				return &backupResult{status: work.Status}, ctx.Err()
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		<-started
+
+		for i := 0; sample.completed; i++ {
+			if res, ok := e.Result(string(ib.UID)); ok && res.State == executor.StateDone {
+				break
+			}
+
+			if i == 100 {
+				t.Fatalf("%s not completed", sample.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		for i := 0; ; i++ {
+			res, err := r.finalize(context.Background(), ib)
+			if err != nil {
+				t.Fatalf("unexpected error on %s %v", sample.name, err)
+			}
+
+			if res.RequeueAfter == 0 {
+				break
+			}
+
+			if i == 100 {
+				t.Fatalf("%s not stopped", sample.name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		exists, err := reg.Exists(context.Background(), newImage)
+		if err != nil {
+			t.Fatalf("unexpected error on %s %v", sample.name, err)
+		}
+
+		if expected, got := sample.exists, exists; expected != got {
+			t.Errorf("backup image existence does not match on %s, expected %t got %t", sample.name, expected, got)
+		}
+
+		if _, ok := e.Result(string(ib.UID)); ok {
+			t.Errorf("expected forgotten executor result on %s", sample.name)
+		}
+
+		cancel()
+		s.Close()
+	}
+}
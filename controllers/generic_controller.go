@@ -21,13 +21,18 @@ import (
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/policy"
 	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"strings"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -35,29 +40,68 @@ import (
 
 const defaultRequeueDuration = time.Second * 5
 
+// reasonManualRolloutRequired is the workload event reason on OnDelete update strategy workloads
+const reasonManualRolloutRequired = "ManualRolloutRequired"
+
 // ImagePredicateFilter filters non image backup
 type ImagePredicateFilter interface {
 	IsNonImageBackup(image string) bool
 }
 
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+
 // GenericReconciler reconciles workload objects
 type GenericReconciler struct {
 	client.Client
 	Log      logr.Logger
 	Registry registry.DockerRegistry
+	// PinDigest rewrites workload images pinned to the backup image digest
+	PinDigest bool
+	// PullSecretInjection defines how rewritten workloads reference backup registry pull secret, None if empty
+	PullSecretInjection string
+	// PullSecretName is the backup registry pull secret name, DefaultPullSecretName if empty
+	PullSecretName string
+	// Replicas are the replica destinations of each primary destination
+	Replicas map[string][]string
+	// Policy decides which images are backed up, any image is backed up if empty
+	Policy *policy.Policy
+	// Recorder reports image policy denials on workloads
+	Recorder record.EventRecorder
+
+	denials denialReports
 }
 
-func (r *GenericReconciler) reconcile(ctx context.Context, req ctrl.Request, obj client.Object) (ctrl.Result, error) {
+func (r *GenericReconciler) reconcile(ctx context.Context, req ctrl.Request, obj client.Object, accessor PodTemplateAccessor) (ctrl.Result, error) {
+	ref, err := r.workloadReference(obj, req.NamespacedName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
 		if errors.IsNotFound(err) {
-			// resource has been deleted, skip
-			return ctrl.Result{}, nil
+			// resource has been deleted, release its image backups
+			r.denials.forget(ref.Key())
+			return ctrl.Result{}, r.pruneConsumers(ctx, ref, nil)
 		}
 
 		return ctrl.Result{}, fmt.Errorf("unable to get resource %s error %v", req.NamespacedName, err)
 	}
 
-	processing, newInitContainersUpdated, err := r.processContainers(ctx, req.Namespace, req.Name, initContainers(obj), obj)
+	spec, err := accessor.PodSpec(obj)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to access pod template %s, error %w", req.NamespacedName, err)
+	}
+
+	if err := r.pruneConsumers(ctx, ref, spec); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to prune image backup consumers, error %w", err)
+	}
+
+	secrets, err := r.pullSecrets(ctx, ref.Namespace, spec)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to get pull secrets %s, error %w", req.NamespacedName, err)
+	}
+
+	processing, newInitContainersUpdated, err := r.processContainers(ctx, ref, spec.InitContainers, secrets, obj)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("unable to process initcontainers, error %w", err)
 	}
@@ -66,7 +110,7 @@ func (r *GenericReconciler) reconcile(ctx context.Context, req ctrl.Request, obj
 		return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
 	}
 
-	processing, newContainersUpdated, err := r.processContainers(ctx, req.Namespace, req.Name, containers(obj), obj)
+	processing, newContainersUpdated, err := r.processContainers(ctx, ref, spec.Containers, secrets, obj)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("unable to process containers, error %w", err)
 	}
@@ -79,6 +123,19 @@ func (r *GenericReconciler) reconcile(ctx context.Context, req ctrl.Request, obj
 		return ctrl.Result{}, nil
 	}
 
+	if hasImmutablePodTemplate(obj) {
+		r.Log.Info("Backup images ready, pod template is immutable, skip roll out", "resource", req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.injectPullSecret(ctx, ref.Namespace, spec); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to inject pull secret %s, error %w", req.NamespacedName, err)
+	}
+
+	if err := accessor.SetPodSpec(obj, spec); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to update pod template %s, error %w", req.NamespacedName, err)
+	}
+
 	r.Log.Info("Rolling out updated Backup image", "resource", req.NamespacedName)
 	if err := r.Update(ctx, obj); err != nil {
 		if errors.IsNotFound(err) {
@@ -96,23 +153,46 @@ func (r *GenericReconciler) reconcile(ctx context.Context, req ctrl.Request, obj
 		return ctrl.Result{}, err
 	}
 
+	r.reportManualRollout(obj)
+
 	return ctrl.Result{}, nil
 }
 
-func (r *GenericReconciler) processContainers(ctx context.Context, ns, name string, cs []corev1.Container, obj client.Object) (processing bool, needsUpdate bool, err error) {
+func (r *GenericReconciler) processContainers(ctx context.Context, ref v1alpha1.WorkloadReference, cs []corev1.Container, secrets []corev1.SecretReference, obj client.Object) (processing bool, needsUpdate bool, err error) {
+	ns, name := ref.Namespace, ref.Name
 	for i, container := range cs {
+		consumer := ref
+		consumer.Container = container.Name
 		if !r.Registry.IsNonImageBackup(container.Image) {
+			newImage, err := r.failover(ctx, consumer, container.Image)
+			if err != nil {
+				return false, false, fmt.Errorf("unable to check backup image %s failover, error %w", container.Image, err)
+			}
+
+			if newImage != "" {
+				r.Log.Info("Backup destination failover", "resource", ns+"/"+name, "from", cs[i].Image, "to", newImage)
+				cs[i].Image = newImage
+				needsUpdate = true
+			}
 			continue
 		}
 
-		ib := &v1alpha1.ImageBackup{}
-		ibName := v1alpha1.ImageBackupNameFromImage(container.Image)
-		err := r.Get(ctx, types.NamespacedName{Namespace: imageBackupNamespace, Name: ibName}, ib)
-		if err != nil && !errors.IsNotFound(err) {
+		if r.denied(obj, ref.Key(), container.Image) {
+			continue
+		}
+
+		destination, err := r.route(ctx, ns, container.Image)
+		if err != nil {
+			return true, false, err
+		}
+
+		ib, err := r.findImageBackup(ctx, container.Image, destination)
+		if err != nil {
 			return false, false, fmt.Errorf("unexpected error %w getting resource %s/%s", err, ns, name)
 		}
 
-		if errors.IsNotFound(err) {
+		if ib == nil {
+			ibName := v1alpha1.ImageBackupName(container.Image, destination)
 			r.Log.Info("No ImageBackup found, create it", "key", ns+"/"+name)
 			if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, obj); err != nil {
 				if errors.IsNotFound(err) {
@@ -123,7 +203,8 @@ func (r *GenericReconciler) processContainers(ctx context.Context, ns, name stri
 				return true, false, fmt.Errorf("unexpected error getting resource %s error %w", ns+"/"+name, err)
 			}
 
-			ib = newImageBackup(imageBackupNamespace, ibName, container.Image)
+			ib = newImageBackup(imageBackupNamespace, ibName, container.Image, destination, consumer, secrets)
+			ib.Spec.Replicas = r.Replicas[destination]
 			if err := r.Create(ctx, ib); err != nil {
 				if errors.IsAlreadyExists(err) {
 					r.Log.Info("ImageBackup already exists", "key", ibName)
@@ -136,12 +217,22 @@ func (r *GenericReconciler) processContainers(ctx context.Context, ns, name stri
 			continue
 		}
 
-		if ib.Status.Phase != v1alpha1.PhaseDone {
+		added, err := r.addConsumer(ctx, ib, consumer, secrets)
+		if err != nil {
+			return true, false, err
+		}
+
+		if added || ib.Status.Phase != v1alpha1.PhaseDone {
 			processing = true
 			continue
 		}
 
-		newImage, err := r.Registry.BackupImageName(container.Image)
+		if !r.pullable(ib.ActiveDestination()) {
+			// local store backups can not be pulled, workloads keep source images
+			continue
+		}
+
+		newImage, err := r.rewriteImage(ib, ib.ActiveDestination())
 		if err != nil {
 			err = fmt.Errorf("unable to build image  %s new name, error %w", container.Image, err)
 			r.Log.Error(err, "imageName", "processContainers", container.Image, "newImage", newImage)
@@ -156,36 +247,265 @@ func (r *GenericReconciler) processContainers(ctx context.Context, ns, name stri
 	return processing, needsUpdate, nil
 }
 
-func newImageBackup(ns, name, img string) *v1alpha1.ImageBackup {
+// findImageBackup looks up destination ImageBackup by its image field index, nil is returned if none is found.
+// Image is matched again as readers without the field index ignore it
+func (r *GenericReconciler) findImageBackup(ctx context.Context, image, destination string) (*v1alpha1.ImageBackup, error) {
+	l := &v1alpha1.ImageBackupList{}
+	if err := r.List(ctx, l, client.InNamespace(imageBackupNamespace), client.MatchingFields{v1alpha1.ImageField: image}); err != nil {
+		return nil, err
+	}
+
+	for i := range l.Items {
+		if l.Items[i].Spec.Image == image && l.Items[i].Spec.Destination == destination {
+			return &l.Items[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// SetupWithManager registers ImageBackup image and consumer field indexes, it must be called before workload controllers start
+func (r *GenericReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(ctx, &v1alpha1.ImageBackup{}, v1alpha1.ImageField, func(o client.Object) []string {
+		ib, ok := o.(*v1alpha1.ImageBackup)
+		if !ok || ib.Spec.Image == "" {
+			return nil
+		}
+
+		return []string{ib.Spec.Image}
+	})
+	if err != nil {
+		return err
+	}
+
+	return mgr.GetFieldIndexer().IndexField(ctx, &v1alpha1.ImageBackup{}, v1alpha1.ConsumerField, func(o client.Object) []string {
+		ib, ok := o.(*v1alpha1.ImageBackup)
+		if !ok {
+			return nil
+		}
+
+		keys := map[string]struct{}{}
+		for _, c := range ib.Spec.Consumers {
+			keys[c.Key()] = struct{}{}
+		}
+
+		res := make([]string, 0, len(keys))
+		for k := range keys {
+			res = append(res, k)
+		}
+
+		return res
+	})
+}
+
+// addConsumer registers workload container as ImageBackup consumer along with its pull secrets, it reports if
+// ImageBackup has been updated
+func (r *GenericReconciler) addConsumer(ctx context.Context, ib *v1alpha1.ImageBackup, consumer v1alpha1.WorkloadReference, secrets []corev1.SecretReference) (bool, error) {
+	updated := mergeSecretReferences(ib, secrets)
+	found := false
+	for _, c := range ib.Spec.Consumers {
+		if c == consumer {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		ib.Spec.Consumers = append(ib.Spec.Consumers, consumer)
+		updated = true
+	}
+
+	if !updated {
+		return false, nil
+	}
+
+	if err := r.Update(ctx, ib); err != nil {
+		if errors.IsNotFound(err) || errors.IsConflict(err) {
+			// retried on next requeue
+			return true, nil
+		}
+
+		return false, fmt.Errorf("unable to add consumer to image backup %s, error %w", ib.Name, err)
+	}
+
+	return true, nil
+}
+
+// pruneConsumers removes workload consumer references from ImageBackups no longer used by its containers,
+// nil pod spec removes all workload references
+func (r *GenericReconciler) pruneConsumers(ctx context.Context, ref v1alpha1.WorkloadReference, spec *corev1.PodSpec) error {
+	l := &v1alpha1.ImageBackupList{}
+	if err := r.List(ctx, l, client.InNamespace(imageBackupNamespace), client.MatchingFields{v1alpha1.ConsumerField: ref.Key()}); err != nil {
+		return err
+	}
+
+	for i := range l.Items {
+		ib := &l.Items[i]
+		consumers := make([]v1alpha1.WorkloadReference, 0, len(ib.Spec.Consumers))
+		for _, c := range ib.Spec.Consumers {
+			if c.Key() == ref.Key() && !r.usesImageBackup(spec, c.Container, ib) {
+				continue
+			}
+			consumers = append(consumers, c)
+		}
+
+		if len(consumers) == len(ib.Spec.Consumers) {
+			continue
+		}
+
+		r.Log.Info("Removing image backup consumer", "key", ib.Name, "workload", ref.Key())
+		ib.Spec.Consumers = consumers
+		if err := r.Update(ctx, ib); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to update image backup %s consumers, error %w", ib.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// usesImageBackup checks if pod spec container uses ImageBackup source image or its backup image on any destination
+func (r *GenericReconciler) usesImageBackup(spec *corev1.PodSpec, container string, ib *v1alpha1.ImageBackup) bool {
+	if spec == nil {
+		return false
+	}
+
+	images := []string{ib.Spec.Image}
+	for _, destination := range ib.Destinations() {
+		backupImage, err := destinationImageName(r.Registry, destination, ib.Spec.Image)
+		if err != nil {
+			return true
+		}
+		images = append(images, backupImage)
+	}
+
+	for _, cs := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range cs {
+			if c.Name != container {
+				continue
+			}
+
+			for i, image := range images {
+				if c.Image == image || (i > 0 && strings.HasPrefix(c.Image, image+"@")) {
+					return true
+				}
+			}
+
+			return false
+		}
+	}
+
+	return false
+}
+
+// workloadReference builds workload reference from object type, container is not filled
+func (r *GenericReconciler) workloadReference(obj client.Object, key types.NamespacedName) (v1alpha1.WorkloadReference, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme())
+	if err != nil {
+		return v1alpha1.WorkloadReference{}, fmt.Errorf("unable to get resource %s kind, error %w", key, err)
+	}
+
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	return v1alpha1.WorkloadReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  key.Namespace,
+		Name:       key.Name,
+	}, nil
+}
+
+// pullSecrets returns pod spec and its ServiceAccount image pull secrets, as kubelet does
+func (r *GenericReconciler) pullSecrets(ctx context.Context, ns string, spec *corev1.PodSpec) ([]corev1.SecretReference, error) {
+	refs := spec.ImagePullSecrets
+	saName := spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+
+	sa := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: saName}, sa)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		refs = append(refs, sa.ImagePullSecrets...)
+	}
+
+	var secrets []corev1.SecretReference
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref.Name == "" || seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+		secrets = append(secrets, corev1.SecretReference{Namespace: ns, Name: ref.Name})
+	}
+
+	return secrets, nil
+}
+
+// mergeSecretReferences adds missing pull secrets to ImageBackup, it reports if any secret has been added
+func mergeSecretReferences(ib *v1alpha1.ImageBackup, secrets []corev1.SecretReference) bool {
+	added := false
+	for _, s := range secrets {
+		found := false
+		for _, ref := range ib.Spec.SourcePullSecrets {
+			if ref == s {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			ib.Spec.SourcePullSecrets = append(ib.Spec.SourcePullSecrets, s)
+			added = true
+		}
+	}
+
+	return added
+}
+
+func newImageBackup(ns, name, img, destination string, consumer v1alpha1.WorkloadReference, secrets []corev1.SecretReference) *v1alpha1.ImageBackup {
 	return &v1alpha1.ImageBackup{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: ns,
 			Name:      name,
 		},
 		Spec: v1alpha1.ImageBackupSpec{
-			Image: img,
+			Image:             img,
+			Destination:       destination,
+			Consumers:         []v1alpha1.WorkloadReference{consumer},
+			SourcePullSecrets: secrets,
 		},
 	}
 }
 
-func initContainers(obj client.Object) []corev1.Container {
-	switch o := obj.(type) {
-	case *appsv1.Deployment:
-		return o.Spec.Template.Spec.InitContainers
-	case *appsv1.DaemonSet:
-		return o.Spec.Template.Spec.InitContainers
-	default:
-		return []corev1.Container{}
+// reportManualRollout records a workload warning event if updated backup images are not rolled out automatically
+func (r *GenericReconciler) reportManualRollout(obj client.Object) {
+	if !requiresManualRollout(obj) {
+		return
+	}
+
+	r.Log.Info("Backup image updated on OnDelete strategy, pods must be deleted to roll out", "resource", obj.GetNamespace()+"/"+obj.GetName())
+	if r.Recorder != nil {
+		r.Recorder.Event(obj, corev1.EventTypeWarning, reasonManualRolloutRequired, "backup images updated on OnDelete update strategy, pods must be deleted to roll out")
 	}
 }
 
-func containers(obj client.Object) []corev1.Container {
+// requiresManualRollout reports workloads whose update strategy does not roll out template changes
+func requiresManualRollout(obj client.Object) bool {
 	switch o := obj.(type) {
-	case *appsv1.Deployment:
-		return o.Spec.Template.Spec.Containers
+	case *appsv1.StatefulSet:
+		return o.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType
 	case *appsv1.DaemonSet:
-		return o.Spec.Template.Spec.Containers
+		return o.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType
 	default:
-		return []corev1.Container{}
+		return false
 	}
 }
+
+// hasImmutablePodTemplate reports workloads whose pod template can not be updated once created
+func hasImmutablePodTemplate(obj client.Object) bool {
+	_, ok := obj.(*batchv1.Job)
+	return ok
+}
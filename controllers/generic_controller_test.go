@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"strings"
+	"testing"
+)
+
+func TestUsesImageBackupMatchesSourceAndBackupImages(t *testing.T) {
+	r := &GenericReconciler{Registry: &fakeImageBackupProvider{}}
+	ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: "nginx:1.14.2"}}
+	var testSamples = []struct {
+		image    string
+		expected bool
+	}{
+		{image: "nginx:1.14.2", expected: true},
+		{image: "fake-image-name:1.1.1", expected: true},
+		{image: "fake-image-name:1.1.1@sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c", expected: true},
+		{image: "nginx:1.21", expected: false},
+	}
+
+	for _, sample := range testSamples {
+		spec := &corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "nginx", Image: sample.image}},
+		}
+		if expected, got := sample.expected, r.usesImageBackup(spec, "nginx", ib); expected != got {
+			t.Errorf("values do not match on image %s, expected %t got %t", sample.image, expected, got)
+		}
+	}
+
+	if r.usesImageBackup(nil, "nginx", ib) {
+		t.Error("deleted workloads do not use image backups")
+	}
+}
+
+func TestPullSecretsIncludeServiceAccountSecrets(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "ghcr"}, {Name: "harbor"}},
+	}
+	r := &GenericReconciler{Client: fake.NewClientBuilder().WithObjects(sa).Build()}
+
+	var testSamples = []struct {
+		spec     *corev1.PodSpec
+		expected []string
+	}{
+		{spec: &corev1.PodSpec{}, expected: nil},
+		{spec: &corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "hub"}}}, expected: []string{"hub"}},
+		{spec: &corev1.PodSpec{ServiceAccountName: "app"}, expected: []string{"ghcr", "harbor"}},
+		{spec: &corev1.PodSpec{ServiceAccountName: "app", ImagePullSecrets: []corev1.LocalObjectReference{{Name: "ghcr"}}}, expected: []string{"ghcr", "harbor"}},
+	}
+
+	for _, sample := range testSamples {
+		secrets, err := r.pullSecrets(context.Background(), "default", sample.spec)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		var names []string
+		for _, s := range secrets {
+			if s.Namespace != "default" {
+				t.Errorf("unexpected secret namespace %s", s.Namespace)
+			}
+			names = append(names, s.Name)
+		}
+
+		if expected, got := strings.Join(sample.expected, ","), strings.Join(names, ","); expected != got {
+			t.Errorf("secrets do not match, expected %s got %s", expected, got)
+		}
+	}
+}
+
+func TestMergeSecretReferencesAddsMissingSecrets(t *testing.T) {
+	ib := newImageBackup("image-backup", "nginx", "nginx:1.14.2", "", v1alpha1.WorkloadReference{}, []corev1.SecretReference{{Namespace: "foo", Name: "hub"}})
+
+	if mergeSecretReferences(ib, []corev1.SecretReference{{Namespace: "foo", Name: "hub"}}) {
+		t.Error("unexpected merge of existing secret")
+	}
+
+	if !mergeSecretReferences(ib, []corev1.SecretReference{{Namespace: "bar", Name: "hub"}}) {
+		t.Error("expected secret merge")
+	}
+
+	if expected, got := 2, len(ib.Spec.SourcePullSecrets); expected != got {
+		t.Errorf("secrets do not match, expected %d got %d", expected, got)
+	}
+}
+
+func TestManualRolloutIsReportedAsWorkloadEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Log: logr.Discard(), Recorder: recorder}
+
+	onDelete := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+	onDelete.Spec.UpdateStrategy.Type = appsv1.OnDeleteStatefulSetStrategyType
+	rolling := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"}}
+	rolling.Spec.UpdateStrategy.Type = appsv1.RollingUpdateDaemonSetStrategyType
+
+	r.reportManualRollout(onDelete)
+	r.reportManualRollout(rolling)
+
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+
+	if len(events) != 1 || !strings.HasPrefix(events[0], corev1.EventTypeWarning+" "+reasonManualRolloutRequired) {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestFindImageBackupMatchesImageAndDestination(t *testing.T) {
+	sch := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(sch)
+	newImageBackup := func(image, destination string) *v1alpha1.ImageBackup {
+		return &v1alpha1.ImageBackup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: imageBackupNamespace, Name: v1alpha1.ImageBackupName(image, destination)},
+			Spec:       v1alpha1.ImageBackupSpec{Image: image, Destination: destination},
+		}
+	}
+	// fake client does not index ImageBackups, image field selector is ignored
+	c := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		newImageBackup("redis:6", "eu"),
+		newImageBackup("nginx:1.21", ""),
+		newImageBackup("nginx:1.21", "eu"),
+	).Build()
+	r := &GenericReconciler{Client: c}
+
+	var testSamples = []struct {
+		image       string
+		destination string
+		found       bool
+	}{
+		{image: "nginx:1.21", destination: "eu", found: true},
+		{image: "nginx:1.21", destination: "", found: true},
+		{image: "redis:6", destination: "", found: false},
+		{image: "busybox:1.36", destination: "eu", found: false},
+	}
+
+	for i, sample := range testSamples {
+		ib, err := r.findImageBackup(context.Background(), sample.image, sample.destination)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if expected, got := sample.found, ib != nil; expected != got {
+			t.Fatalf("sample %d found does not match, expected %t got %t", i, expected, got)
+		}
+
+		if ib != nil && (ib.Spec.Image != sample.image || ib.Spec.Destination != sample.destination) {
+			t.Errorf("sample %d unexpected ImageBackup %s %s", i, ib.Spec.Image, ib.Spec.Destination)
+		}
+	}
+}
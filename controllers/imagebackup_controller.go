@@ -18,14 +18,27 @@ package controllers
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/pkg/executor"
 	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
 	"time"
 
 	v1alpha1 "github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
@@ -37,7 +50,8 @@ import (
 const defaultExistenceCheckTimeout = time.Second * 10
 const defaultBackupTimeout = time.Second * 300
 const imageBackupNamespace = "image-backup"
-const imageBackupCleanOutDelay = time.Minute * 5
+const defaultRetentionTTL = time.Minute * 5
+const defaultMaxRetries = 5
 
 // ImageBackupReconciler reconciles a ImageBackup object
 type ImageBackupReconciler struct {
@@ -45,10 +59,38 @@ type ImageBackupReconciler struct {
 	Scheme   *runtime.Scheme
 	Log      logr.Logger
 	Registry registry.DockerRegistry
+	// APIReader reads source pull secrets bypassing the cache, controller client is used if empty
+	APIReader client.Reader
+	// RefreshPolicy is the default upstream tag drift refresh policy, Never if empty
+	RefreshPolicy string
+	// RefreshInterval is the upstream tag drift check period on Scheduled refresh policy
+	RefreshInterval time.Duration
+	// Retention is the default completed ImageBackup retention policy, 5 minutes TTL if empty
+	Retention v1alpha1.Retention
+	// MaxRetries is the number of failed executions before moving to Failed phase
+	MaxRetries int32
+	// RetryBackoff is the base exponential backoff between failed executions
+	RetryBackoff time.Duration
+	// CleanupAborted removes destination tags of backups aborted on deletion
+	CleanupAborted bool
+	// HealthCheckInterval is the replicated backups destinations health check period, 1 minute if empty
+	HealthCheckInterval time.Duration
+	// Executor runs backups out of the reconciliation loop, a default executor is used if empty
+	Executor *executor.Executor
+	// Verifier gates backups on source image signatures, signatures are not verified if empty
+	Verifier registry.Verifier
+	// Resolver resolves source image digests, source registries are requested anonymously if empty
+	Resolver registry.SourceResolver
+
+	events chan event.GenericEvent
+	stop   chan struct{}
 }
 
 //+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=get;list;watch;update;delete
 //+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,6 +109,19 @@ func (r *ImageBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	r.Log.V(10).Info("Reconcile Image Backup", "key", req.NamespacedName, "status", ib.Status.Phase)
 
+	if !ib.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, ib)
+	}
+
+	if !controllerutil.ContainsFinalizer(ib, v1alpha1.Finalizer) {
+		controllerutil.AddFinalizer(ib, v1alpha1.Finalizer)
+		// update triggers a new reconciliation
+		return r.update(ctx, ib)
+	}
+
+	// completed executor job key, its result is released once status is updated
+	var completed string
+
 	switch ib.Status.Phase {
 	case "":
 		now := metav1.Now()
@@ -77,30 +132,150 @@ func (r *ImageBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		ib.Status.Phase = v1alpha1.PhaseRunning
 		ib.Status.CreateAt = &now
 	case v1alpha1.PhaseRunning:
-		if err := r.execute(ctx, ib); err != nil {
-			r.Log.Error(err, "unexpected error", "execute", ib.Name)
-			return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
+		if ib.Status.NextRetryAt != nil {
+			if wait := time.Until(ib.Status.NextRetryAt.Time); wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+		}
+
+		key := string(ib.UID)
+		res, ok := r.Executor.Result(key)
+		if !ok {
+			if err := r.submit(ib); err != nil {
+				r.Log.Error(err, "unable to submit image backup", "key", ib.Name)
+				return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
+			}
+
+			if c := meta.FindStatusCondition(ib.Status.Conditions, v1alpha1.ConditionCopied); c != nil && c.Reason == reasonQueued {
+				return ctrl.Result{}, nil
+			}
+			setCondition(ib, v1alpha1.ConditionCopied, metav1.ConditionUnknown, reasonQueued, "backup queued")
+			ib.Status.Progress = nil
+			break
+		}
+
+		if res.State != executor.StateDone {
+			// completion is notified by executor, meanwhile copy progress is reported
+			p, _ := res.Progress.(*v1alpha1.BackupProgress)
+			if p == nil || equality.Semantic.DeepEqual(p, ib.Status.Progress) {
+				return ctrl.Result{}, nil
+			}
+
+			ib.Status.Progress = p.DeepCopy()
+			break
+		}
+		completed = key
+
+		out, _ := res.Value.(*backupResult)
+		if out != nil {
+			out.apply(ib)
+		}
+
+		if res.Err != nil {
+			r.Log.Error(res.Err, "unexpected error", "execute", ib.Name)
+			r.failed(ib, res.Err)
+			break
 		}
 		d := metav1.Duration{Duration: time.Since(ib.Status.CreateAt.Time)}
 		ib.Status.ExecutionDuration = &d
+		ib.Status.Digest = out.digest
+		ib.Status.LastError = ""
+		ib.Status.NextRetryAt = nil
 		ib.Status.Phase = v1alpha1.PhaseDone
+	case v1alpha1.PhaseFailed:
+		if _, ok := ib.Annotations[v1alpha1.RetryAnnotation]; !ok {
+			return ctrl.Result{}, nil
+		}
+
+		r.Log.Info("Retrying failed image backup", "key", ib.Name)
+		delete(ib.Annotations, v1alpha1.RetryAnnotation)
+		if err := r.Update(ctx, ib); err != nil {
+			if errors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+
+			if errors.IsConflict(err) {
+				return ctrl.Result{RequeueAfter: time.Second}, nil
+			}
+
+			return ctrl.Result{}, err
+		}
+
+		// pending backups run again from scratch
+		ib.Status.Phase = v1alpha1.PhasePending
+		ib.Status.Attempts = 0
+		ib.Status.NextRetryAt = nil
 	case v1alpha1.PhaseDone:
-		// delete resource 5 min after completion
-		if time.Since(ib.Status.CreateAt.Time.Add(ib.Status.ExecutionDuration.Duration)) <= imageBackupCleanOutDelay {
-			return ctrl.Result{RequeueAfter: imageBackupCleanOutDelay}, nil
+		if len(ib.Spec.Replicas) > 0 {
+			changed, ready := r.checkDestinations(ctx, ib)
+			if !ready {
+				r.Log.Info("Backup image replica lost, backup again", "key", ib.Name)
+				ib.Status.Phase = v1alpha1.PhaseRunning
+				break
+			}
+
+			if changed {
+				break
+			}
+
+			if d := destinationStatus(ib, ib.Spec.Destination); !d.Healthy {
+				// primary destination is unreachable, workloads use the active replica meanwhile
+				return ctrl.Result{RequeueAfter: r.healthCheckInterval()}, nil
+			}
 		}
 
-		r.Log.Info("Removing expired image backup", "key", ib.Name)
-		if err := r.Delete(ctx, ib); err != nil {
-			if !errors.IsNotFound(err) {
-				r.Log.Error(err, "unable to delete resource", "key", ib.Name)
+		verified, err := r.verify(ctx, ib)
+		if err != nil {
+			r.Log.Error(err, "unable to verify backup image digest", "key", ib.Name)
+			return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
+		}
+
+		if !verified {
+			r.Log.Info("Backup image digest changed, backup again", "key", ib.Name, "digest", ib.Status.Digest)
+			setCondition(ib, v1alpha1.ConditionVerified, metav1.ConditionFalse, reasonDigestMismatch, "backup image digest does not match "+ib.Status.Digest)
+			ib.Status.Phase = v1alpha1.PhaseRunning
+			ib.Status.Digest = ""
+			break
+		}
+
+		next, due := r.nextDriftCheck(ib)
+		if due {
+			refresh, err := r.refreshOnDrift(r.sourceContext(ctx, ib), ib)
+			if err != nil {
+				r.Log.Error(err, "unable to check upstream drift", "key", ib.Name)
+				return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
 			}
+
+			if refresh {
+				ib.Status.Phase = v1alpha1.PhaseRunning
+			}
+			break
 		}
 
-		return ctrl.Result{}, nil
+		res, changed, err := r.retain(ctx, ib)
+		if err != nil {
+			r.Log.Error(err, "unable to apply retention", "key", ib.Name)
+			return ctrl.Result{RequeueAfter: defaultRequeueDuration}, nil
+		}
+
+		if changed {
+			break
+		}
+
+		if next > 0 && (res.RequeueAfter == 0 || next < res.RequeueAfter) {
+			res.RequeueAfter = next
+		}
+
+		if health := r.healthCheckInterval(); len(ib.Spec.Replicas) > 0 && (res.RequeueAfter == 0 || health < res.RequeueAfter) {
+			res.RequeueAfter = health
+		}
+
+		return res, nil
 	}
 
 	// update status
+	ib.Status.ObservedGeneration = ib.Generation
+	setReadyCondition(ib)
 	err = r.Status().Update(ctx, ib)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -119,26 +294,178 @@ func (r *ImageBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
+	if completed != "" {
+		r.Executor.Forget(completed)
+	}
+
+	if ib.Status.Phase == v1alpha1.PhaseRunning && ib.Status.NextRetryAt != nil {
+		return ctrl.Result{RequeueAfter: time.Until(ib.Status.NextRetryAt.Time)}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// update updates ImageBackup object, conflicts are requeued
+func (r *ImageBackupReconciler) update(ctx context.Context, ib *v1alpha1.ImageBackup) (ctrl.Result, error) {
+	if err := r.Update(ctx, ib); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		if errors.IsConflict(err) {
+			return ctrl.Result{RequeueAfter: time.Second}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// failed records execution error, backup is retried with exponential backoff until max retries are reached
+func (r *ImageBackupReconciler) failed(ib *v1alpha1.ImageBackup, err error) {
+	ib.Status.Attempts++
+	ib.Status.LastError = err.Error()
+
+	if goerrors.Is(err, registry.ErrSignatureNotVerified) {
+		// retrying does not sign the image, retry annotation runs it again once signed
+		r.Log.Info("Image backup failed, signature not verified", "key", ib.Name)
+		ib.Status.Phase = v1alpha1.PhaseFailed
+		ib.Status.NextRetryAt = nil
+		return
+	}
+
+	maxRetries := r.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+
+	if ib.Status.Attempts >= maxRetries {
+		r.Log.Info("Image backup failed, max retries reached", "key", ib.Name, "attempts", ib.Status.Attempts)
+		ib.Status.Phase = v1alpha1.PhaseFailed
+		ib.Status.NextRetryAt = nil
+		return
+	}
+
+	base := r.RetryBackoff
+	if base <= 0 {
+		base = defaultRequeueDuration
+	}
+
+	next := metav1.NewTime(time.Now().Add(retryBackoff(base, defaultMaxRetryBackoff, ib.Status.Attempts)))
+	ib.Status.NextRetryAt = &next
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ImageBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	pr := predicate.And(
 		IgnoreDeleteEvents(),
 		IgnoreGenericEvents(),
 	)
+
+	if r.Executor == nil {
+		r.Executor = executor.New(r.Log.WithName("executor"))
+	}
+
+	if err := mgr.Add(r.Executor); err != nil {
+		return fmt.Errorf("unable to add executor, error %w", err)
+	}
+
+	r.events = make(chan event.GenericEvent)
+	r.stop = make(chan struct{})
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(r.stop)
+		return nil
+	})); err != nil {
+		return fmt.Errorf("unable to add notifier stop, error %w", err)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.ImageBackup{}, builder.WithPredicates(pr)).
+		Watches(&source.Channel{Source: r.events}, &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
 
-func (r *ImageBackupReconciler) execute(ctx context.Context, ib *v1alpha1.ImageBackup) error {
-	newImage, err := r.Registry.BackupImageName(ib.Spec.Image)
+// submit queues ImageBackup execution, execution runs on a working copy whose status is applied once completed
+func (r *ImageBackupReconciler) submit(ib *v1alpha1.ImageBackup) error {
+	work := ib.DeepCopy()
+	notify := &v1alpha1.ImageBackup{ObjectMeta: metav1.ObjectMeta{Namespace: ib.Namespace, Name: ib.Name}}
+
+	return r.Executor.Submit(executor.Job{
+		Key:      string(ib.UID),
+		Registry: registry.SourceRegistry(ib.Spec.Image),
+		Run: func(ctx context.Context, report executor.ReportFunc) (interface{}, error) {
+			var reportedAt time.Time
+			digest, err := r.execute(ctx, work, func(p *v1alpha1.BackupProgress) {
+				if time.Since(reportedAt) < progressUpdateInterval {
+					return
+				}
+				reportedAt = time.Now()
+				report(p)
+				r.notify(notify)
+			})
+			return &backupResult{digest: digest, status: work.Status}, err
+		},
+		Done: func() {
+			r.notify(notify)
+		},
+	})
+}
+
+// notify enqueues ImageBackup reconciliation from executor jobs, pending notifications are dropped on shutdown
+func (r *ImageBackupReconciler) notify(ib *v1alpha1.ImageBackup) {
+	go func() {
+		select {
+		case r.events <- event.GenericEvent{Object: ib}:
+		case <-r.stop:
+		}
+	}()
+}
+
+// backupResult holds execution outcome, status is the working copy status updated on execution
+type backupResult struct {
+	digest string
+	status v1alpha1.ImageBackupStatus
+}
+
+// apply copies execution recorded status to ImageBackup
+func (b *backupResult) apply(ib *v1alpha1.ImageBackup) {
+	for _, c := range b.status.Conditions {
+		meta.SetStatusCondition(&ib.Status.Conditions, c)
+	}
+	ib.Status.SourceDigest = b.status.SourceDigest
+	ib.Status.CopiedFrom = b.status.CopiedFrom
+	ib.Status.Drifted = b.status.Drifted
+	ib.Status.LastDriftCheck = b.status.LastDriftCheck
+	ib.Status.Destinations = b.status.Destinations
+	ib.Status.Artifacts = b.status.Artifacts
+	if b.status.Progress != nil {
+		ib.Status.Progress = b.status.Progress
+	}
+}
+
+func (r *ImageBackupReconciler) execute(ctx context.Context, ib *v1alpha1.ImageBackup, report func(*v1alpha1.BackupProgress)) (string, error) {
+	ctx = r.sourceContext(ctx, ib)
+	newImage, err := backupImageName(r.Registry, ib)
 	if err != nil {
 		err = fmt.Errorf("unable to build image  %s new name, error %w", ib.Spec.Image, err)
 		r.Log.Error(err, "execute", "image", ib.Spec.Image)
-		return err
+		return "", err
+	}
+
+	resolveCtx, resolveCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	srcDigest, err := r.sourceDigest(resolveCtx, ib.Spec.Image)
+	resolveCancel()
+	if err != nil {
+		setCondition(ib, v1alpha1.ConditionSourceResolved, metav1.ConditionFalse, reasonResolutionFailed, err.Error())
+		return "", fmt.Errorf("unable to resolve source image %s, error %w", ib.Spec.Image, err)
+	}
+	ib.Status.SourceDigest = srcDigest
+	setCondition(ib, v1alpha1.ConditionSourceResolved, metav1.ConditionTrue, reasonResolved, srcDigest)
+
+	if err := r.verifySignature(ctx, ib, srcDigest); err != nil {
+		return "", err
 	}
 
 	existsCtx, existsCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
@@ -147,25 +474,363 @@ func (r *ImageBackupReconciler) execute(ctx context.Context, ib *v1alpha1.ImageB
 		existsCancel()
 		err = fmt.Errorf("unable to check image %s existence, error %w", ib.Spec.Image, err)
 		r.Log.Error(err, "execute", "exists", ib.Spec.Image, "newImage", newImage)
-		return err
+		return "", err
 	}
 	existsCancel()
 
+	if !exists {
+		// missing backup images are owned by this ImageBackup, only those are removed if backup is aborted
+		recordDestination(ib, v1alpha1.DestinationStatus{Destination: ib.Spec.Destination, Image: newImage, CopyStarted: true})
+	}
+
+	if exists {
+		refresh, err := r.refreshOnDrift(ctx, ib)
+		if err != nil {
+			return "", err
+		}
+
+		exists = !refresh
+	}
+
 	if !exists {
 		r.Log.Info("Creating Backup Image", "src", ib.Spec.Image, "dst", newImage)
 		ctx, cancel := context.WithTimeout(ctx, defaultBackupTimeout)
-		if err := r.Registry.Backup(ctx, ib.Spec.Image, newImage); err != nil {
+		startedAt := time.Now()
+		var last registry.Progress
+		progress := registry.WithProgress(func(p registry.Progress) {
+			last = p
+			report(backupProgress(p, startedAt, time.Now()))
+		})
+		var artifacts []v1alpha1.BackupArtifact
+		artifactReport := registry.WithArtifactReport(func(a registry.Artifact) {
+			artifacts = append(artifacts, v1alpha1.BackupArtifact{Kind: a.Kind, Subject: a.Subject, Digest: a.Digest, Reference: a.Reference})
+		})
+		// source is pinned to the resolved digest, so that moved tags never copy an unverified image
+		src := registry.PinnedImageName(ib.Spec.Image, srcDigest)
+		if err := r.Registry.Backup(ctx, src, newImage, progress, artifactReport); err != nil {
 			cancel()
+			setCondition(ib, v1alpha1.ConditionCopied, metav1.ConditionFalse, reasonCopyFailed, err.Error())
 			err = fmt.Errorf("unable to backup image %s, error %w", ib.Spec.Image, err)
 			r.Log.Error(err, "execute", "backup", ib.Spec.Image, "newImage", newImage)
-			return err
+			return "", err
 		}
 		cancel()
+		ib.Status.Progress = backupProgress(last, startedAt, time.Now())
+		ib.Status.CopiedFrom = srcDigest
+		ib.Status.Artifacts = artifacts
+		ib.Status.Drifted = false
+		setCondition(ib, v1alpha1.ConditionCopied, metav1.ConditionTrue, reasonCopied, newImage)
 		r.Log.Info("Backup Image Completed", "src", ib.Spec.Image, "dst", newImage)
+	} else {
+		setCondition(ib, v1alpha1.ConditionCopied, metav1.ConditionTrue, reasonAlreadyExists, newImage)
+		r.Log.Info("Backup Image already exists", "src", ib.Spec.Image, "dst", newImage)
+	}
+
+	digestCtx, digestCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	defer digestCancel()
+	digest, err := r.Registry.Digest(digestCtx, newImage)
+	if err != nil {
+		setCondition(ib, v1alpha1.ConditionVerified, metav1.ConditionFalse, reasonVerifyFailed, err.Error())
+		return "", fmt.Errorf("unable to get backup image %s digest, error %w", newImage, err)
+	}
+	setCondition(ib, v1alpha1.ConditionVerified, metav1.ConditionTrue, reasonDigestRecorded, digest)
+	recordDestination(ib, v1alpha1.DestinationStatus{Destination: ib.Spec.Destination, Image: newImage, Digest: digest, Ready: true, Healthy: true})
+
+	if err := r.replicate(ctx, ib, digest, report); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// sourceDigest resolves source image digest, source digests never depend on backup destinations
+func (r *ImageBackupReconciler) sourceDigest(ctx context.Context, image string) (string, error) {
+	if r.Resolver == nil {
+		return registry.NewSourceResolver(nil).Digest(ctx, image)
+	}
+
+	return r.Resolver.Digest(ctx, image)
+}
+
+// sourceContext authenticates source image requests from ImageBackup pull secrets, missing or invalid secrets
+// are skipped so that backup registry credentials are used
+func (r *ImageBackupReconciler) sourceContext(ctx context.Context, ib *v1alpha1.ImageBackup) context.Context {
+	if len(ib.Spec.SourcePullSecrets) == 0 {
+		return ctx
+	}
+
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+
+	var secrets []corev1.Secret
+	for _, ref := range ib.Spec.SourcePullSecrets {
+		s := corev1.Secret{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, &s); err != nil {
+			r.Log.Error(err, "unable to get source pull secret", "key", ib.Name, "secret", ref.Namespace+"/"+ref.Name)
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+
+	kc, err := registry.NewPullSecretKeychain(secrets)
+	if err != nil {
+		r.Log.Error(err, "unable to build source keychain", "key", ib.Name)
+		return ctx
+	}
+
+	return registry.WithSourceKeychain(ctx, kc)
+}
+
+// verifySignature checks source image signatures if a verifier is configured, unverified images are reported as
+// SignatureNotVerified so that they are never backed up nor rewritten
+func (r *ImageBackupReconciler) verifySignature(ctx context.Context, ib *v1alpha1.ImageBackup, digest string) error {
+	if r.Verifier == nil {
 		return nil
 	}
 
-	r.Log.Info("Backup Image already exists", "src", ib.Spec.Image, "dst", newImage)
+	verifyCtx, verifyCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	defer verifyCancel()
+	if err := r.Verifier.Verify(verifyCtx, ib.Spec.Image, digest); err != nil {
+		reason := reasonVerifyFailed
+		if goerrors.Is(err, registry.ErrSignatureNotVerified) {
+			reason = reasonSignatureNotVerified
+		}
+		setCondition(ib, v1alpha1.ConditionSignatureVerified, metav1.ConditionFalse, reason, err.Error())
+		return fmt.Errorf("unable to verify image %s signature, error %w", ib.Spec.Image, err)
+	}
 
+	setCondition(ib, v1alpha1.ConditionSignatureVerified, metav1.ConditionTrue, reasonSignatureVerified, digest)
 	return nil
 }
+
+// verify checks backup image digest still matches the recorded one, backups without recorded digest are verified
+func (r *ImageBackupReconciler) verify(ctx context.Context, ib *v1alpha1.ImageBackup) (bool, error) {
+	if ib.Status.Digest == "" {
+		return true, nil
+	}
+
+	newImage, err := backupImageName(r.Registry, ib)
+	if err != nil {
+		return false, fmt.Errorf("unable to build image  %s new name, error %w", ib.Spec.Image, err)
+	}
+
+	digestCtx, digestCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	defer digestCancel()
+	digest, err := r.Registry.Digest(digestCtx, newImage)
+	if err != nil {
+		return false, fmt.Errorf("unable to get backup image %s digest, error %w", newImage, err)
+	}
+
+	return digest == ib.Status.Digest, nil
+}
+
+// refreshOnDrift compares source and backup image digests recording drift on status, it reports
+// if backup must be refreshed according to refresh policy
+func (r *ImageBackupReconciler) refreshOnDrift(ctx context.Context, ib *v1alpha1.ImageBackup) (bool, error) {
+	if strings.Contains(ib.Spec.Image, "@") {
+		// digest references are immutable
+		return false, nil
+	}
+
+	newImage, err := backupImageName(r.Registry, ib)
+	if err != nil {
+		return false, fmt.Errorf("unable to build image  %s new name, error %w", ib.Spec.Image, err)
+	}
+
+	digestCtx, digestCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	defer digestCancel()
+	srcDigest, err := r.sourceDigest(digestCtx, ib.Spec.Image)
+	if err != nil {
+		return false, fmt.Errorf("unable to get source image %s digest, error %w", ib.Spec.Image, err)
+	}
+
+	dstDigest, err := r.Registry.Digest(digestCtx, newImage)
+	if err != nil {
+		return false, fmt.Errorf("unable to get backup image %s digest, error %w", newImage, err)
+	}
+
+	now := metav1.Now()
+	ib.Status.LastDriftCheck = &now
+	ib.Status.SourceDigest = srcDigest
+
+	// platform filtered backups do not hold source index digest, the copied source digest is compared instead.
+	// Backups whose copied source digest is unknown take the current source digest as reference
+	copiedFrom := ib.Status.CopiedFrom
+	if copiedFrom == "" {
+		r.Log.Info("Unknown backup source digest, current source digest taken as reference", "src", ib.Spec.Image, "srcDigest", srcDigest, "dstDigest", dstDigest)
+		copiedFrom = srcDigest
+	}
+
+	ib.Status.Drifted = srcDigest != copiedFrom
+	if !ib.Status.Drifted {
+		ib.Status.CopiedFrom = srcDigest
+		return false, nil
+	}
+
+	driftDetected.Inc()
+	if r.refreshPolicy(ib) == v1alpha1.RefreshPolicyNever {
+		r.Log.Info("Upstream tag drift detected, refresh not allowed", "src", ib.Spec.Image, "srcDigest", srcDigest, "copiedFrom", copiedFrom)
+		return false, nil
+	}
+
+	driftRefreshed.Inc()
+	r.Log.Info("Upstream tag drift detected, refresh backup", "src", ib.Spec.Image, "srcDigest", srcDigest, "copiedFrom", copiedFrom)
+	return true, nil
+}
+
+// nextDriftCheck returns the remaining time to the next scheduled drift check and if it is already due
+func (r *ImageBackupReconciler) nextDriftCheck(ib *v1alpha1.ImageBackup) (time.Duration, bool) {
+	if r.refreshPolicy(ib) != v1alpha1.RefreshPolicyScheduled || r.RefreshInterval <= 0 {
+		return 0, false
+	}
+
+	if ib.Status.LastDriftCheck == nil {
+		return 0, true
+	}
+
+	next := time.Until(ib.Status.LastDriftCheck.Add(r.RefreshInterval))
+	return next, next <= 0
+}
+
+func (r *ImageBackupReconciler) refreshPolicy(ib *v1alpha1.ImageBackup) string {
+	if ib.Spec.RefreshPolicy != "" {
+		return ib.Spec.RefreshPolicy
+	}
+
+	if r.RefreshPolicy != "" {
+		return r.RefreshPolicy
+	}
+
+	return v1alpha1.RefreshPolicyNever
+}
+
+// retain applies retention policy to completed ImageBackups, it reports if status has been changed
+func (r *ImageBackupReconciler) retain(ctx context.Context, ib *v1alpha1.ImageBackup) (ctrl.Result, bool, error) {
+	policy, ttl := r.retention(ib)
+	switch policy {
+	case v1alpha1.RetentionForever:
+		return ctrl.Result{}, false, nil
+	case v1alpha1.RetentionWhileReferenced:
+		pruned, err := r.pruneMissingConsumers(ctx, ib)
+		if err != nil || pruned {
+			// consumers update triggers a new reconciliation
+			return ctrl.Result{}, false, err
+		}
+
+		if len(ib.Spec.Consumers) > 0 {
+			if ib.Status.OrphanedAt == nil {
+				return ctrl.Result{}, false, nil
+			}
+
+			ib.Status.OrphanedAt = nil
+			return ctrl.Result{}, true, nil
+		}
+
+		if ib.Status.OrphanedAt == nil {
+			r.Log.Info("Image backup without consumers, orphaned", "key", ib.Name, "grace", ttl)
+			now := metav1.Now()
+			ib.Status.OrphanedAt = &now
+			return ctrl.Result{}, true, nil
+		}
+
+		if remaining := ttl - time.Since(ib.Status.OrphanedAt.Time); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, false, nil
+		}
+	default:
+		completedAt := ib.Status.CreateAt.Time
+		if ib.Status.ExecutionDuration != nil {
+			completedAt = completedAt.Add(ib.Status.ExecutionDuration.Duration)
+		}
+
+		if remaining := ttl - time.Since(completedAt); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, false, nil
+		}
+	}
+
+	r.Log.Info("Removing expired image backup", "key", ib.Name, "retention", policy)
+	if err := r.Delete(ctx, ib); err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, false, fmt.Errorf("unable to delete resource %s, error %w", ib.Name, err)
+	}
+
+	return ctrl.Result{}, false, nil
+}
+
+// retention returns ImageBackup retention policy and its ttl, object retention overrides controller retention
+func (r *ImageBackupReconciler) retention(ib *v1alpha1.ImageBackup) (string, time.Duration) {
+	ret := r.Retention
+	if ib.Spec.Retention != nil {
+		ret = *ib.Spec.Retention
+	}
+
+	policy := ret.Policy
+	if policy == "" {
+		policy = v1alpha1.RetentionTTL
+	}
+
+	ttl := defaultRetentionTTL
+	if ret.TTL != nil {
+		ttl = ret.TTL.Duration
+	}
+
+	return policy, ttl
+}
+
+// pruneMissingConsumers removes consumers whose workload no longer exists, workload delete events
+// may be lost while the controller is not running
+func (r *ImageBackupReconciler) pruneMissingConsumers(ctx context.Context, ib *v1alpha1.ImageBackup) (bool, error) {
+	missing := map[string]bool{}
+	for _, c := range ib.Spec.Consumers {
+		if _, ok := missing[c.Key()]; ok {
+			continue
+		}
+
+		exists, err := r.workloadExists(ctx, c)
+		if err != nil {
+			r.Log.Error(err, "unable to check consumer existence", "key", ib.Name, "consumer", c.Key())
+			exists = true
+		}
+		missing[c.Key()] = !exists
+	}
+
+	consumers := make([]v1alpha1.WorkloadReference, 0, len(ib.Spec.Consumers))
+	for _, c := range ib.Spec.Consumers {
+		if !missing[c.Key()] {
+			consumers = append(consumers, c)
+		}
+	}
+
+	if len(consumers) == len(ib.Spec.Consumers) {
+		return false, nil
+	}
+
+	r.Log.Info("Removing missing image backup consumers", "key", ib.Name)
+	ib.Spec.Consumers = consumers
+	if err := r.Update(ctx, ib); err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("unable to update image backup %s consumers, error %w", ib.Name, err)
+	}
+
+	return true, nil
+}
+
+func (r *ImageBackupReconciler) workloadExists(ctx context.Context, ref v1alpha1.WorkloadReference) (bool, error) {
+	gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
+	var obj client.Object
+	if o, err := r.Scheme.New(gvk); err == nil {
+		obj, _ = o.(client.Object)
+	}
+
+	if obj == nil {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		obj = u
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, obj)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// JobReconciler reconciles standalone Job objects, Job pod templates are immutable so that
+// backup images are created but never rolled out
+type JobReconciler struct {
+	*GenericReconciler
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+}
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=create;get;list;update;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *JobReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	job := &batchv1.Job{}
+	return r.reconcile(ctx, req, job, JobPodTemplate)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *JobReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, ns *NamespaceSelector) error {
+	pr := predicate.And(
+		IgnoreGenericEvents(),
+		SelectedNamespaces(ns),
+		StandaloneJobSucceeded(),
+		JobHasNonBackupImage(fn.IsNonImageBackup),
+	)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&batchv1.Job{}, builder.WithPredicates(pr)).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, namespaceRequests(r.Client, ns, func() client.ObjectList { return &batchv1.JobList{} }, pr), builder.WithPredicates(NamespaceLabelsChanged())).
+		Complete(r)
+}
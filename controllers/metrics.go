@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	driftDetected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_backup_drift_detected_total",
+		Help: "The total number of upstream tag drifts detected on backed up images",
+	})
+
+	driftRefreshed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_backup_drift_refresh_total",
+		Help: "The total number of backups refreshed on upstream tag drift",
+	})
+)
+
+func init() {
+	// Register custom metrics with the global prometheus registry
+	metrics.Registry.MustRegister(driftDetected, driftRefreshed)
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"path"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NamespaceSelector selects reconciled workload namespaces, Include and Exclude are glob patterns and empty
+// Include selects any namespace. Namespace labels are only fetched if Selector is defined
+type NamespaceSelector struct {
+	Include  []string
+	Exclude  []string
+	Selector labels.Selector
+	// Reader gets namespaces labels, usually the manager cached client
+	Reader client.Reader
+}
+
+// Selected checks if namespace is selected, namespaces that can not be fetched are not selected
+func (s *NamespaceSelector) Selected(ctx context.Context, namespace string) bool {
+	if s == nil {
+		return true
+	}
+
+	if !s.selectedName(namespace) {
+		return false
+	}
+
+	if s.Selector == nil || s.Selector.Empty() {
+		return true
+	}
+
+	n := &corev1.Namespace{}
+	if err := s.Reader.Get(ctx, types.NamespacedName{Name: namespace}, n); err != nil {
+		return false
+	}
+
+	return s.Selector.Matches(labels.Set(n.Labels))
+}
+
+func (s *NamespaceSelector) selectedName(namespace string) bool {
+	if matchesNamespace(s.Exclude, namespace) {
+		return false
+	}
+
+	return len(s.Include) == 0 || matchesNamespace(s.Include, namespace)
+}
+
+// matchesNamespace checks if namespace matches any glob pattern
+func matchesNamespace(patterns []string, namespace string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, namespace); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SelectedNamespaces filters events from non selected namespaces
+func SelectedNamespaces(s *NamespaceSelector) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ev event.CreateEvent) bool {
+			return s.Selected(context.Background(), ev.Object.GetNamespace())
+		},
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			return s.Selected(context.Background(), ev.ObjectNew.GetNamespace())
+		},
+	}
+}
+
+// NamespaceLabelsChanged filters Namespace events other than labels updates
+func NamespaceLabelsChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ev event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			return !equality.Semantic.DeepEqual(ev.ObjectOld.GetLabels(), ev.ObjectNew.GetLabels())
+		},
+		DeleteFunc: func(ev event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(ev event.GenericEvent) bool {
+			return false
+		},
+	}
+}
+
+// namespaceRequests enqueues namespace workloads accepted by workload predicate once its namespace is selected,
+// workloads are listed into newList typed lists so that they are served from controller cache
+func namespaceRequests(c client.Reader, s *NamespaceSelector, newList func() client.ObjectList, pr predicate.Predicate) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+		ctx := context.Background()
+		if !s.Selected(ctx, o.GetName()) {
+			return nil
+		}
+
+		l := newList()
+		if err := c.List(ctx, l, client.InNamespace(o.GetName())); err != nil {
+			return nil
+		}
+
+		items, err := meta.ExtractList(l)
+		if err != nil {
+			return nil
+		}
+
+		var res []reconcile.Request
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok || !pr.Create(event.CreateEvent{Object: obj}) {
+				continue
+			}
+			res = append(res, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}})
+		}
+
+		return res
+	})
+}
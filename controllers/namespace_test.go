@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"testing"
+)
+
+func TestNamespaceSelectorSelectsNamespaces(t *testing.T) {
+	enabled := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"image-backup.k8slab.io/enabled": "true"}}}
+	disabled := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}}
+	sandbox := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-sandbox", Labels: map[string]string{"image-backup.k8slab.io/enabled": "true"}}}
+	c := fake.NewClientBuilder().WithObjects(enabled, disabled, sandbox).Build()
+	optIn := labels.SelectorFromSet(labels.Set{"image-backup.k8slab.io/enabled": "true"})
+
+	var testSamples = []struct {
+		selector  *NamespaceSelector
+		namespace string
+		selected  bool
+	}{
+		{selector: nil, namespace: "kube-system", selected: true},
+		{selector: &NamespaceSelector{Exclude: []string{"kube-*"}}, namespace: "kube-system", selected: false},
+		{selector: &NamespaceSelector{Exclude: []string{"kube-*"}}, namespace: "default", selected: true},
+		{selector: &NamespaceSelector{Include: []string{"team-*"}}, namespace: "default", selected: false},
+		{selector: &NamespaceSelector{Include: []string{"team-*"}, Exclude: []string{"team-sandbox"}}, namespace: "team-sandbox", selected: false},
+		{selector: &NamespaceSelector{Selector: optIn, Reader: c}, namespace: "team-a", selected: true},
+		{selector: &NamespaceSelector{Selector: optIn, Reader: c}, namespace: "team-b", selected: false},
+		{selector: &NamespaceSelector{Selector: optIn, Reader: c}, namespace: "unknown", selected: false},
+		{selector: &NamespaceSelector{Selector: labels.Everything(), Exclude: []string{"team-a"}}, namespace: "team-b", selected: true},
+	}
+
+	for i, sample := range testSamples {
+		if expected, got := sample.selected, sample.selector.Selected(context.Background(), sample.namespace); expected != got {
+			t.Errorf("sample %d namespace %s selection does not match, expected %t got %t", i, sample.namespace, expected, got)
+		}
+	}
+}
+
+func TestNamespaceLabelsChangedFiltersNamespaceEvents(t *testing.T) {
+	old := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	labeled := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"image-backup.k8slab.io/enabled": "true"}}}
+	annotated := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Annotations: map[string]string{"foo": "bar"}}}
+
+	pr := NamespaceLabelsChanged()
+	if pr.Create(event.CreateEvent{Object: labeled}) {
+		t.Error("expected filtered create event")
+	}
+
+	if !pr.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: labeled}) {
+		t.Error("expected labels update event")
+	}
+
+	if pr.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: annotated}) {
+		t.Error("expected filtered annotations update event")
+	}
+}
+
+func TestNamespaceRequestsEnqueuesSelectedNamespaceWorkloads(t *testing.T) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"image-backup.k8slab.io/enabled": "true"}}}
+	c := fake.NewClientBuilder().WithObjects(
+		ns,
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "foo"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "bar"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "baz"}},
+	).Build()
+	s := &NamespaceSelector{Selector: labels.SelectorFromSet(labels.Set{"image-backup.k8slab.io/enabled": "true"}), Reader: c}
+	onlyFoo := predicate.NewPredicateFuncs(func(o client.Object) bool { return o.GetName() == "foo" })
+	h := namespaceRequests(c, s, func() client.ObjectList { return &appsv1.DeploymentList{} }, onlyFoo)
+
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	h.Update(event.UpdateEvent{ObjectOld: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}, ObjectNew: ns}, q)
+	if expected, got := 1, q.Len(); expected != got {
+		t.Fatalf("enqueued requests do not match, expected %d got %d", expected, got)
+	}
+
+	item, _ := q.Get()
+	if expected, got := (reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "team-a", Name: "foo"}}), item; expected != got {
+		t.Errorf("request does not match, expected %v got %v", expected, got)
+	}
+
+	unlabeled := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}}
+	h.Update(event.UpdateEvent{ObjectOld: unlabeled, ObjectNew: unlabeled}, q)
+	if q.Len() != 0 {
+		t.Errorf("expected no requests from non selected namespace, got %d", q.Len())
+	}
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+)
+
+// PodTemplateAccessor gives access to the pod spec declared by a workload kind
+type PodTemplateAccessor interface {
+	PodSpec(obj client.Object) (*corev1.PodSpec, error)
+	SetPodSpec(obj client.Object, spec *corev1.PodSpec) error
+}
+
+// PodTemplateFunc adapts typed workloads to PodTemplateAccessor, pod spec is returned by reference
+type PodTemplateFunc func(obj client.Object) (*corev1.PodTemplateSpec, bool)
+
+// PodSpec returns workload pod spec
+func (f PodTemplateFunc) PodSpec(obj client.Object) (*corev1.PodSpec, error) {
+	tpl, ok := f(obj)
+	if !ok {
+		return nil, fmt.Errorf("unexpected workload type %T", obj)
+	}
+
+	return &tpl.Spec, nil
+}
+
+// SetPodSpec replaces workload pod spec
+func (f PodTemplateFunc) SetPodSpec(obj client.Object, spec *corev1.PodSpec) error {
+	tpl, ok := f(obj)
+	if !ok {
+		return fmt.Errorf("unexpected workload type %T", obj)
+	}
+
+	if &tpl.Spec != spec {
+		tpl.Spec = *spec
+	}
+
+	return nil
+}
+
+// DeploymentPodTemplate accesses Deployment pod templates
+var DeploymentPodTemplate = PodTemplateFunc(func(obj client.Object) (*corev1.PodTemplateSpec, bool) {
+	d, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return nil, false
+	}
+
+	return &d.Spec.Template, true
+})
+
+// DaemonSetPodTemplate accesses DaemonSet pod templates
+var DaemonSetPodTemplate = PodTemplateFunc(func(obj client.Object) (*corev1.PodTemplateSpec, bool) {
+	d, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return nil, false
+	}
+
+	return &d.Spec.Template, true
+})
+
+// StatefulSetPodTemplate accesses StatefulSet pod templates
+var StatefulSetPodTemplate = PodTemplateFunc(func(obj client.Object) (*corev1.PodTemplateSpec, bool) {
+	s, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return nil, false
+	}
+
+	return &s.Spec.Template, true
+})
+
+// CronJobPodTemplate accesses CronJob job template pod templates
+var CronJobPodTemplate = PodTemplateFunc(func(obj client.Object) (*corev1.PodTemplateSpec, bool) {
+	c, ok := obj.(*batchv1.CronJob)
+	if !ok {
+		return nil, false
+	}
+
+	return &c.Spec.JobTemplate.Spec.Template, true
+})
+
+// JobPodTemplate accesses Job pod templates
+var JobPodTemplate = PodTemplateFunc(func(obj client.Object) (*corev1.PodTemplateSpec, bool) {
+	j, ok := obj.(*batchv1.Job)
+	if !ok {
+		return nil, false
+	}
+
+	return &j.Spec.Template, true
+})
+
+type unstructuredPodTemplate struct {
+	fields []string
+}
+
+// NewUnstructuredPodTemplate accesses unstructured workloads pod templates located on a JSONPath
+// field expression, as {.spec.template} or .spec.template
+func NewUnstructuredPodTemplate(path string) (PodTemplateAccessor, error) {
+	fields, err := parseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unstructuredPodTemplate{fields: fields}, nil
+}
+
+// PodSpec returns a copy of the workload pod spec
+func (u *unstructuredPodTemplate) PodSpec(obj client.Object) (*corev1.PodSpec, error) {
+	uns, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected workload type %T", obj)
+	}
+
+	m, found, err := unstructured.NestedMap(uns.Object, u.fields...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get pod template from %s, error %w", strings.Join(u.fields, "."), err)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("pod template %s not found on %s", strings.Join(u.fields, "."), uns.GetKind())
+	}
+
+	tpl := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, tpl); err != nil {
+		return nil, fmt.Errorf("unable to convert pod template, error %w", err)
+	}
+
+	return &tpl.Spec, nil
+}
+
+// SetPodSpec writes pod spec back to the workload pod template
+func (u *unstructuredPodTemplate) SetPodSpec(obj client.Object, spec *corev1.PodSpec) error {
+	uns, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected workload type %T", obj)
+	}
+
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(spec)
+	if err != nil {
+		return fmt.Errorf("unable to convert pod spec, error %w", err)
+	}
+
+	return unstructured.SetNestedMap(uns.Object, m, append(u.fields, "spec")...)
+}
+
+// parseFieldPath translates a JSONPath field expression into its field names
+func parseFieldPath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+
+	parser, err := jsonpath.Parse("podTemplate", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse path %s, error %w", path, err)
+	}
+
+	var fields []string
+	for _, root := range parser.Root.Nodes {
+		list, ok := root.(*jsonpath.ListNode)
+		if !ok {
+			return nil, fmt.Errorf("unsupported path %s", path)
+		}
+
+		for _, n := range list.Nodes {
+			f, ok := n.(*jsonpath.FieldNode)
+			if !ok {
+				return nil, fmt.Errorf("unsupported path %s, only field expressions are allowed", path)
+			}
+
+			fields = append(fields, f.Value)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty path %s", path)
+	}
+
+	return fields, nil
+}
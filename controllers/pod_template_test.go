@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+func TestUnstructuredPodTemplateAccessorUpdatesImages(t *testing.T) {
+	for _, path := range []string{"{.spec.workerTemplate}", ".spec.workerTemplate"} {
+		accessor, err := NewUnstructuredPodTemplate(path)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		obj := getFakeUnstructuredWorkload("goo/bar:1.2.3")
+		spec, err := accessor.PodSpec(obj)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if expected, got := "goo/bar:1.2.3", spec.Containers[0].Image; expected != got {
+			t.Fatalf("images do not match, expected %s got %s", expected, got)
+		}
+
+		spec.Containers[0].Image = "foo/goo_bar:1.2.3"
+		if err := accessor.SetPodSpec(obj, spec); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workerTemplate", "spec", "containers")
+		if expected, got := "foo/goo_bar:1.2.3", containers[0].(map[string]interface{})["image"]; expected != got {
+			t.Errorf("images do not match, expected %s got %s", expected, got)
+		}
+	}
+}
+
+func TestUnstructuredPodTemplateAccessorRejectsNonFieldPaths(t *testing.T) {
+	if _, err := NewUnstructuredPodTemplate("{.spec.templates[0]}"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHasNonBackupImageOnUnstructuredWorkload(t *testing.T) {
+	accessor, err := NewUnstructuredPodTemplate("{.spec.workerTemplate}")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	fn := func(img string) bool {
+		return img == "goo/bar:1.2.3"
+	}
+	if !hasNonBackupImage(accessor, getFakeUnstructuredWorkload("goo/bar:1.2.3"), fn) {
+		t.Error("Expected call")
+	}
+
+	if hasNonBackupImage(accessor, getFakeUnstructuredWorkload("foo/goo_bar:1.2.3"), fn) {
+		t.Error("Not expected call")
+	}
+}
+
+func getFakeUnstructuredWorkload(img string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "k8slab.io/v1",
+			"kind":       "Worker",
+			"metadata": map[string]interface{}{
+				"namespace": "default",
+				"name":      "goo",
+			},
+			"spec": map[string]interface{}{
+				"workerTemplate": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":  "worker",
+								"image": img,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
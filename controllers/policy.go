@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/marcosQuesada/image-backup-controller/pkg/policy"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sync"
+)
+
+// reasonBackupDenied is the workload event reason on images denied by image policy
+const reasonBackupDenied = "BackupDenied"
+
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+type policyFilter struct {
+	filter ImagePredicateFilter
+	policy *policy.Policy
+}
+
+// NewPolicyFilter filters non image backups skipped by image policy, denied images are kept so that its
+// workloads are reconciled to report the denial
+func NewPolicyFilter(filter ImagePredicateFilter, p *policy.Policy) ImagePredicateFilter {
+	return policyFilter{filter: filter, policy: p}
+}
+
+// IsNonImageBackup checks if image is a non image backup not skipped by image policy
+func (f policyFilter) IsNonImageBackup(image string) bool {
+	return f.filter.IsNonImageBackup(image) && f.policy.Evaluate(image).Action != policy.ActionSkip
+}
+
+// denied reports if image policy does not allow image backup, denials are recorded as workload warning events
+// once per workload revision
+func (r *GenericReconciler) denied(obj client.Object, key, image string) bool {
+	d := r.Policy.Evaluate(image)
+	if d.Allowed() {
+		return false
+	}
+
+	if d.Action != policy.ActionDeny {
+		return true
+	}
+
+	revision := fmt.Sprintf("%s/%d", obj.GetUID(), obj.GetGeneration())
+	if !r.denials.report(key, revision, image) {
+		return true
+	}
+
+	rule := d.Rule
+	if rule == "" {
+		rule = "default action"
+	}
+
+	r.Log.Info("Image backup denied by policy", "resource", obj.GetNamespace()+"/"+obj.GetName(), "image", image, "rule", rule)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, reasonBackupDenied, "image %s backup denied by policy rule %s", image, rule)
+	}
+
+	return true
+}
+
+// denialReports records reported workload image denials, so that resyncs do not report them again
+type denialReports struct {
+	mutex   sync.Mutex
+	reports map[string]map[string]string
+}
+
+// report records workload image denial on workload revision, it reports if denial is new
+func (d *denialReports) report(key, revision, image string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.reports == nil {
+		d.reports = map[string]map[string]string{}
+	}
+
+	if d.reports[key] == nil {
+		d.reports[key] = map[string]string{}
+	}
+
+	if d.reports[key][image] == revision {
+		return false
+	}
+
+	d.reports[key][image] = revision
+	return true
+}
+
+// forget releases deleted workload denials
+func (d *denialReports) forget(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.reports, key)
+}
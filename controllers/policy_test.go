@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/pkg/policy"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"strings"
+	"testing"
+)
+
+func TestPolicyFilterSkipsImagesOnPredicates(t *testing.T) {
+	p, err := policy.New(policy.ActionAllow,
+		policy.Rule{Name: "internal", Action: policy.ActionSkip, Registries: []string{"registry.internal.example.com"}},
+		policy.Rule{Name: "no-latest", Action: policy.ActionDeny, Tags: []string{"latest"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	pr := DeploymentHasNonBackupImage(NewPolicyFilter(registry.NewDockerRegistry("docker.io/backup/", "foo", "bar"), p).IsNonImageBackup)
+	var testSamples = []struct {
+		image    string
+		expected bool
+	}{
+		{image: "registry.internal.example.com/app:1.0.0", expected: false},
+		{image: "nginx:latest", expected: true},
+		{image: "nginx:1.14.2", expected: true},
+		{image: "docker.io/backup/nginx:1.14.2", expected: false},
+	}
+
+	for _, sample := range testSamples {
+		if expected, got := sample.expected, pr.Create(event.CreateEvent{Object: getFakePod("default", "goo", sample.image)}); expected != got {
+			t.Errorf("predicate does not match on %s, expected %t got %t", sample.image, expected, got)
+		}
+	}
+}
+
+func TestDeniedImagesAreReportedAsWorkloadEvents(t *testing.T) {
+	p, err := policy.New(policy.ActionAllow,
+		policy.Rule{Name: "internal", Action: policy.ActionSkip, Registries: []string{"registry.internal.example.com"}},
+		policy.Rule{Name: "no-latest", Action: policy.ActionDeny, Tags: []string{"latest"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &GenericReconciler{Log: logr.Discard(), Policy: p, Recorder: recorder}
+	obj := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx", UID: "uid", Generation: 1}}
+	key := "Deployment.apps/default/nginx"
+
+	if r.denied(obj, key, "nginx:1.14.2") {
+		t.Error("unexpected denied image")
+	}
+
+	if !r.denied(obj, key, "registry.internal.example.com/app:1.0.0") {
+		t.Error("expected skipped image")
+	}
+
+	if !r.denied(obj, key, "nginx") {
+		t.Error("expected denied image")
+	}
+
+	// resyncs keep denying the image without reporting it again
+	if !r.denied(obj, key, "nginx") {
+		t.Error("expected denied image")
+	}
+
+	// denial is reported again on workload spec changes and workload recreation
+	obj.Generation = 2
+	r.denied(obj, key, "nginx")
+	r.denials.forget(key)
+	r.denied(obj, key, "nginx")
+
+	close(recorder.Events)
+	var events []string
+	for e := range recorder.Events {
+		events = append(events, e)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	for _, e := range events {
+		if !strings.Contains(e, reasonBackupDenied) || !strings.Contains(e, "no-latest") {
+			t.Errorf("unexpected event %s", e)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
@@ -26,28 +29,6 @@ func IgnoreGenericEvents() predicate.Predicate {
 	}
 }
 
-// IgnoreRestrictedNamespaces filters events from restricted namespaces
-func IgnoreRestrictedNamespaces(restricted []string) predicate.Predicate {
-	return predicate.Funcs{
-		CreateFunc: func(ev event.CreateEvent) bool {
-			return !isRestrictedNamespace(restricted, ev.Object.GetNamespace())
-		},
-		UpdateFunc: func(ev event.UpdateEvent) bool {
-			return !isRestrictedNamespace(restricted, ev.ObjectNew.GetNamespace())
-		},
-	}
-}
-
-func isRestrictedNamespace(restricted []string, namespace string) bool {
-	for _, s := range restricted {
-		if namespace == s {
-			return true
-		}
-	}
-
-	return false
-}
-
 // DeploymentReady filters deployment objects that are not in ready state
 func DeploymentReady() predicate.Predicate {
 	return predicate.Funcs{
@@ -98,64 +79,154 @@ func isDaemonSetReady(o runtime.Object) bool {
 	return d.Status.DesiredNumberScheduled == d.Status.NumberReady
 }
 
-// DeploymentHasNonBackupImage filters deployments using non-backup registry images
-func DeploymentHasNonBackupImage(isNonBackupImage func(string) bool) predicate.Predicate {
+// StatefulSetReady filters statefulSets objects that are not in ready state
+func StatefulSetReady() predicate.Predicate {
 	return predicate.Funcs{
 		CreateFunc: func(ev event.CreateEvent) bool {
-			return hasDeploymentNonBackupImage(ev.Object, isNonBackupImage)
+			return isStatefulSetReady(ev.Object)
 		},
 		UpdateFunc: func(ev event.UpdateEvent) bool {
-			return hasDeploymentNonBackupImage(ev.ObjectNew, isNonBackupImage)
+			return isStatefulSetReady(ev.ObjectNew)
 		},
 	}
 }
 
-func hasDeploymentNonBackupImage(o runtime.Object, isNonBackupImage func(string) bool) bool {
-	d, ok := o.(*appsv1.Deployment)
+func isStatefulSetReady(o runtime.Object) bool {
+	s, ok := o.(*appsv1.StatefulSet)
 	if !ok {
 		return false
 	}
 
-	for _, container := range d.Spec.Template.Spec.InitContainers {
-		if isNonBackupImage(container.Image) {
-			return true
-		}
+	desired := int32(1)
+	if s.Spec.Replicas != nil {
+		desired = *s.Spec.Replicas
 	}
 
-	for _, container := range d.Spec.Template.Spec.Containers {
-		if isNonBackupImage(container.Image) {
-			return true
+	if desired == 0 {
+		return false
+	}
+
+	if s.Status.ReadyReplicas != desired {
+		return false
+	}
+
+	// partitioned rolling updates only roll out ordinals greater or equal than partition,
+	// the remaining replicas stay on the current revision
+	ru := s.Spec.UpdateStrategy.RollingUpdate
+	if s.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType || ru == nil || ru.Partition == nil {
+		return true
+	}
+
+	expectedUpdated := desired - *ru.Partition
+	if expectedUpdated < 0 {
+		expectedUpdated = 0
+	}
+
+	return s.Status.UpdatedReplicas >= expectedUpdated
+}
+
+// CronJobSucceeded filters cronJobs objects without any successful scheduled execution
+func CronJobSucceeded() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ev event.CreateEvent) bool {
+			return hasCronJobSucceeded(ev.Object)
+		},
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			return hasCronJobSucceeded(ev.ObjectNew)
+		},
+	}
+}
+
+func hasCronJobSucceeded(o runtime.Object) bool {
+	c, ok := o.(*batchv1.CronJob)
+	if !ok {
+		return false
+	}
+
+	return c.Status.LastSuccessfulTime != nil
+}
+
+// StandaloneJobSucceeded filters jobs owned by cronJobs and jobs without succeeded pods
+func StandaloneJobSucceeded() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ev event.CreateEvent) bool {
+			return isStandaloneJobSucceeded(ev.Object)
+		},
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			return isStandaloneJobSucceeded(ev.ObjectNew)
+		},
+	}
+}
+
+func isStandaloneJobSucceeded(o runtime.Object) bool {
+	j, ok := o.(*batchv1.Job)
+	if !ok {
+		return false
+	}
+
+	for _, ref := range j.OwnerReferences {
+		if ref.Kind == "CronJob" {
+			return false
 		}
 	}
 
-	return false
+	return j.Status.Succeeded > 0
+}
+
+// DeploymentHasNonBackupImage filters deployments using non-backup registry images
+func DeploymentHasNonBackupImage(isNonBackupImage func(string) bool) predicate.Predicate {
+	return HasNonBackupImage(DeploymentPodTemplate, isNonBackupImage)
 }
 
 // DaemonSetHasNonBackupImage filters daemonSets using non-backup registry images
 func DaemonSetHasNonBackupImage(isNonBackupImage func(string) bool) predicate.Predicate {
+	return HasNonBackupImage(DaemonSetPodTemplate, isNonBackupImage)
+}
+
+// StatefulSetHasNonBackupImage filters statefulSets using non-backup registry images
+func StatefulSetHasNonBackupImage(isNonBackupImage func(string) bool) predicate.Predicate {
+	return HasNonBackupImage(StatefulSetPodTemplate, isNonBackupImage)
+}
+
+// CronJobHasNonBackupImage filters cronJobs using non-backup registry images
+func CronJobHasNonBackupImage(isNonBackupImage func(string) bool) predicate.Predicate {
+	return HasNonBackupImage(CronJobPodTemplate, isNonBackupImage)
+}
+
+// JobHasNonBackupImage filters jobs using non-backup registry images
+func JobHasNonBackupImage(isNonBackupImage func(string) bool) predicate.Predicate {
+	return HasNonBackupImage(JobPodTemplate, isNonBackupImage)
+}
+
+// HasNonBackupImage filters workloads using non-backup registry images
+func HasNonBackupImage(accessor PodTemplateAccessor, isNonBackupImage func(string) bool) predicate.Predicate {
 	return predicate.Funcs{
 		CreateFunc: func(ev event.CreateEvent) bool {
-			return hasDaemonSetNonBackupImage(ev.Object, isNonBackupImage)
+			return hasNonBackupImage(accessor, ev.Object, isNonBackupImage)
 		},
 		UpdateFunc: func(ev event.UpdateEvent) bool {
-			return hasDaemonSetNonBackupImage(ev.ObjectNew, isNonBackupImage)
+			return hasNonBackupImage(accessor, ev.ObjectNew, isNonBackupImage)
 		},
 	}
 }
 
-func hasDaemonSetNonBackupImage(o runtime.Object, isNonBackupImage func(string) bool) bool {
-	d, ok := o.(*appsv1.DaemonSet)
-	if !ok {
+func hasNonBackupImage(accessor PodTemplateAccessor, o client.Object, isNonBackupImage func(string) bool) bool {
+	if o == nil {
+		return false
+	}
+
+	spec, err := accessor.PodSpec(o)
+	if err != nil {
 		return false
 	}
 
-	for _, container := range d.Spec.Template.Spec.InitContainers {
+	for _, container := range spec.InitContainers {
 		if isNonBackupImage(container.Image) {
 			return true
 		}
 	}
 
-	for _, container := range d.Spec.Template.Spec.Containers {
+	for _, container := range spec.Containers {
 		if isNonBackupImage(container.Image) {
 			return true
 		}
@@ -163,3 +234,31 @@ func hasDaemonSetNonBackupImage(o runtime.Object, isNonBackupImage func(string)
 
 	return false
 }
+
+// ActiveDestinationChanged filters ImageBackup events other than completed backups active destination switches
+func ActiveDestinationChanged() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(ev event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			o, ok := ev.ObjectOld.(*v1alpha1.ImageBackup)
+			if !ok {
+				return false
+			}
+
+			n, ok := ev.ObjectNew.(*v1alpha1.ImageBackup)
+			if !ok {
+				return false
+			}
+
+			return n.Status.Phase == v1alpha1.PhaseDone && o.ActiveDestination() != n.ActiveDestination()
+		},
+		DeleteFunc: func(ev event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(ev event.GenericEvent) bool {
+			return false
+		},
+	}
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -40,11 +41,11 @@ func TestIgnoreGenericEvents(t *testing.T) {
 	}
 }
 
-func TestIgnoreRestrictedNamespaces(t *testing.T) {
+func TestSelectedNamespaces(t *testing.T) {
 	restrictedNamespace := "foo"
 	restricted := []string{restrictedNamespace}
 
-	p := IgnoreRestrictedNamespaces(restricted)
+	p := SelectedNamespaces(&NamespaceSelector{Exclude: restricted})
 	if !p.Create(event.CreateEvent{
 		Object: &v1alpha1.ImageBackup{
 			ObjectMeta: metav1.ObjectMeta{
@@ -105,6 +106,119 @@ func TestDaemonSetHasNonBackupImage(t *testing.T) {
 
 }
 
+func TestStatefulSetHasNonBackupImage(t *testing.T) {
+	backupRegistry := "foo"
+	fn := func(img string) bool {
+		return !strings.HasPrefix(img, backupRegistry)
+	}
+	p := StatefulSetHasNonBackupImage(fn)
+	if !p.Create(event.CreateEvent{
+		Object: getFakeStatefulSet("default", "goo", "goo/bar:1.2.3"),
+	}) {
+		t.Error("Expected call")
+	}
+
+	if p.Create(event.CreateEvent{
+		Object: getFakeStatefulSet("default", "goo", backupRegistry+"/bar:1.2.3"),
+	}) {
+		t.Error("Not expected call")
+	}
+}
+
+func TestStatefulSetReadyOnPartitionedRollingUpdate(t *testing.T) {
+	var testSamples = []struct {
+		partition int32
+		ready     int32
+		updated   int32
+		expected  bool
+	}{
+		{partition: 0, ready: 3, updated: 3, expected: true},
+		{partition: 0, ready: 3, updated: 1, expected: false},
+		{partition: 2, ready: 3, updated: 1, expected: true},
+		{partition: 2, ready: 2, updated: 1, expected: false},
+		{partition: 5, ready: 3, updated: 0, expected: true},
+	}
+
+	p := StatefulSetReady()
+	for _, sample := range testSamples {
+		sts := getFakeStatefulSet("default", "goo", "goo/bar:1.2.3")
+		sts.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+				Partition: &sample.partition,
+			},
+		}
+		sts.Status.ReadyReplicas = sample.ready
+		sts.Status.UpdatedReplicas = sample.updated
+
+		if expected, got := sample.expected, p.Create(event.CreateEvent{Object: sts}); expected != got {
+			t.Errorf("ready does not match on partition %d ready %d updated %d, expected %t got %t", sample.partition, sample.ready, sample.updated, expected, got)
+		}
+	}
+}
+
+func TestCronJobSucceeded(t *testing.T) {
+	p := CronJobSucceeded()
+	cj := getFakeCronJob("default", "goo", "goo/bar:1.2.3")
+	if p.Create(event.CreateEvent{
+		Object: cj,
+	}) {
+		t.Error("Not expected call")
+	}
+
+	now := metav1.Now()
+	cj.Status.LastSuccessfulTime = &now
+	if !p.Create(event.CreateEvent{
+		Object: cj,
+	}) {
+		t.Error("Expected call")
+	}
+}
+
+func TestCronJobHasNonBackupImage(t *testing.T) {
+	backupRegistry := "foo"
+	fn := func(img string) bool {
+		return !strings.HasPrefix(img, backupRegistry)
+	}
+	p := CronJobHasNonBackupImage(fn)
+	if !p.Create(event.CreateEvent{
+		Object: getFakeCronJob("default", "goo", "goo/bar:1.2.3"),
+	}) {
+		t.Error("Expected call")
+	}
+
+	if p.Create(event.CreateEvent{
+		Object: getFakeCronJob("default", "goo", backupRegistry+"/bar:1.2.3"),
+	}) {
+		t.Error("Not expected call")
+	}
+}
+
+func TestStandaloneJobSucceededSkipsCronJobOwnedJobs(t *testing.T) {
+	p := StandaloneJobSucceeded()
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "goo",
+		},
+		Status: batchv1.JobStatus{
+			Succeeded: 1,
+		},
+	}
+	if !p.Create(event.CreateEvent{
+		Object: job,
+	}) {
+		t.Error("Expected call")
+	}
+
+	job.OwnerReferences = []metav1.OwnerReference{{Kind: "CronJob", Name: "goo"}}
+	if p.Create(event.CreateEvent{
+		Object: job,
+	}) {
+		t.Error("Not expected call")
+	}
+}
+
 func getFakePod(ns, name, img string) *appsv1.Deployment {
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -144,3 +258,49 @@ func getFakeDaemonSet(ns, name, img string) *appsv1.DaemonSet {
 		},
 	}
 }
+
+func getFakeStatefulSet(ns, name, img string) *appsv1.StatefulSet {
+	replicas := int32(3)
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Image: img,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func getFakeCronJob(ns, name, img string) *batchv1.CronJob {
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+		},
+		Spec: batchv1.CronJobSpec{
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Image: img,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
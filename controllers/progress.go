@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"time"
+)
+
+// progressUpdateInterval throttles copy progress status updates
+const progressUpdateInterval = time.Second * 5
+
+// backupProgress translates registry copy progress to status, ETA is estimated from the average copy rate
+func backupProgress(p registry.Progress, startedAt, now time.Time) *v1alpha1.BackupProgress {
+	started := metav1.NewTime(startedAt)
+	bp := &v1alpha1.BackupProgress{
+		BytesCopied:  p.CompleteBytes,
+		BytesTotal:   p.TotalBytes,
+		LayersCopied: p.CompleteLayers,
+		LayersTotal:  p.TotalLayers,
+		StartedAt:    &started,
+	}
+
+	if p.CompleteBytes <= 0 || p.CompleteBytes >= p.TotalBytes {
+		return bp
+	}
+
+	elapsed := now.Sub(startedAt)
+	remaining := time.Duration(float64(elapsed) * float64(p.TotalBytes-p.CompleteBytes) / float64(p.CompleteBytes))
+	bp.ETA = remaining.Round(time.Second).String()
+
+	return bp
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	"testing"
+	"time"
+)
+
+func TestBackupProgressEstimatesRemainingDuration(t *testing.T) {
+	startedAt := time.Now()
+	var testSamples = []struct {
+		progress registry.Progress
+		elapsed  time.Duration
+		eta      string
+	}{
+		{progress: registry.Progress{TotalBytes: 100, TotalLayers: 2}, elapsed: time.Minute, eta: ""},
+		{progress: registry.Progress{CompleteBytes: 25, TotalBytes: 100, TotalLayers: 2}, elapsed: time.Minute, eta: "3m0s"},
+		{progress: registry.Progress{CompleteBytes: 50, TotalBytes: 100, CompleteLayers: 1, TotalLayers: 2}, elapsed: time.Second * 10, eta: "10s"},
+		{progress: registry.Progress{CompleteBytes: 100, TotalBytes: 100, CompleteLayers: 2, TotalLayers: 2}, elapsed: time.Minute, eta: ""},
+	}
+
+	for _, sample := range testSamples {
+		bp := backupProgress(sample.progress, startedAt, startedAt.Add(sample.elapsed))
+		if bp.ETA != sample.eta {
+			t.Errorf("eta does not match, expected %q got %q", sample.eta, bp.ETA)
+		}
+
+		if bp.BytesCopied != sample.progress.CompleteBytes || bp.LayersTotal != sample.progress.TotalLayers {
+			t.Errorf("progress does not match, expected %+v got %+v", sample.progress, bp)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultPullSecretName is the backup registry pull secret name created on workload namespaces
+const DefaultPullSecretName = "image-backup-registry"
+
+// injectPullSecret ensures backup registry pull secret exists on workload namespace and it is referenced
+// from pod template or its ServiceAccount according to injection mode
+func (r *GenericReconciler) injectPullSecret(ctx context.Context, ns string, spec *corev1.PodSpec) error {
+	if r.PullSecretInjection == "" || r.PullSecretInjection == v1alpha1.PullSecretInjectionNone {
+		return nil
+	}
+
+	name := r.pullSecretName()
+	if err := r.ensurePullSecret(ctx, ns, name); err != nil {
+		return err
+	}
+
+	if r.PullSecretInjection == v1alpha1.PullSecretInjectionPodTemplate {
+		spec.ImagePullSecrets = appendPullSecret(spec.ImagePullSecrets, name)
+		return nil
+	}
+
+	saName := spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+
+	sa := &corev1.ServiceAccount{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ns, Name: saName}, sa); err != nil {
+		return fmt.Errorf("unable to get service account %s/%s, error %w", ns, saName, err)
+	}
+
+	refs := appendPullSecret(sa.ImagePullSecrets, name)
+	if len(refs) == len(sa.ImagePullSecrets) {
+		return nil
+	}
+
+	r.Log.Info("Adding backup registry pull secret to service account", "resource", ns+"/"+saName, "secret", name)
+	sa.ImagePullSecrets = refs
+	return r.Update(ctx, sa)
+}
+
+// ensurePullSecret creates or updates backup registry pull secret, secrets not managed by the controller are
+// referenced but never updated
+func (r *GenericReconciler) ensurePullSecret(ctx context.Context, ns, name string) error {
+	data, err := r.Registry.DockerConfigJSON()
+	if err != nil {
+		return err
+	}
+
+	s := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, s)
+	if errors.IsNotFound(err) {
+		r.Log.Info("Creating backup registry pull secret", "resource", ns+"/"+name)
+		s = newPullSecret(ns, name, data)
+		if err := r.Create(ctx, s); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("unable to create pull secret %s/%s, error %w", ns, name, err)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to get pull secret %s/%s, error %w", ns, name, err)
+	}
+
+	if !isManagedPullSecret(s) || bytes.Equal(s.Data[corev1.DockerConfigJsonKey], data) {
+		return nil
+	}
+
+	s.Data = map[string][]byte{corev1.DockerConfigJsonKey: data}
+	return r.Update(ctx, s)
+}
+
+func (r *GenericReconciler) pullSecretName() string {
+	if r.PullSecretName != "" {
+		return r.PullSecretName
+	}
+
+	return DefaultPullSecretName
+}
+
+func appendPullSecret(refs []corev1.LocalObjectReference, name string) []corev1.LocalObjectReference {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return refs
+		}
+	}
+
+	return append(refs, corev1.LocalObjectReference{Name: name})
+}
+
+func isManagedPullSecret(s *corev1.Secret) bool {
+	return s.Labels[v1alpha1.ManagedByLabel] == v1alpha1.ManagedBy && s.Type == corev1.SecretTypeDockerConfigJson
+}
+
+func newPullSecret(ns, name string, data []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ns,
+			Name:      name,
+			Labels:    map[string]string{v1alpha1.ManagedByLabel: v1alpha1.ManagedBy},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: data},
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"testing"
+)
+
+func TestInjectPullSecretOnPodTemplate(t *testing.T) {
+	r := &GenericReconciler{
+		Client:              fake.NewClientBuilder().Build(),
+		Log:                 logr.Discard(),
+		Registry:            &fakeImageBackupProvider{},
+		PullSecretInjection: v1alpha1.PullSecretInjectionPodTemplate,
+	}
+
+	spec := &corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "hub"}}}
+	for i := 0; i < 2; i++ {
+		if err := r.injectPullSecret(context.Background(), "default", spec); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	if expected, got := 2, len(spec.ImagePullSecrets); expected != got {
+		t.Fatalf("pull secrets do not match, expected %d got %d", expected, got)
+	}
+
+	if expected, got := DefaultPullSecretName, spec.ImagePullSecrets[1].Name; expected != got {
+		t.Errorf("pull secret name does not match, expected %s got %s", expected, got)
+	}
+
+	s := &corev1.Secret{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: DefaultPullSecretName}, s); err != nil {
+		t.Fatalf("pull secret not created, error %v", err)
+	}
+
+	if !isManagedPullSecret(s) {
+		t.Error("expected managed pull secret")
+	}
+}
+
+func TestInjectPullSecretOnServiceAccount(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "default"}}
+	r := &GenericReconciler{
+		Client:              fake.NewClientBuilder().WithObjects(sa).Build(),
+		Log:                 logr.Discard(),
+		Registry:            &fakeImageBackupProvider{},
+		PullSecretInjection: v1alpha1.PullSecretInjectionServiceAccount,
+		PullSecretName:      "backup",
+	}
+
+	spec := &corev1.PodSpec{}
+	if err := r.injectPullSecret(context.Background(), "default", spec); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(spec.ImagePullSecrets) != 0 {
+		t.Errorf("unexpected pod template pull secrets %v", spec.ImagePullSecrets)
+	}
+
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "default"}, sa); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(sa.ImagePullSecrets) != 1 || sa.ImagePullSecrets[0].Name != "backup" {
+		t.Errorf("service account pull secrets do not match, got %v", sa.ImagePullSecrets)
+	}
+}
+
+func TestEnsurePullSecretSyncsManagedSecretsOnly(t *testing.T) {
+	managed := newPullSecret("foo", DefaultPullSecretName, []byte("stale"))
+	unmanaged := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "bar", Name: DefaultPullSecretName},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("custom")},
+	}
+	r := &GenericReconciler{
+		Client:   fake.NewClientBuilder().WithObjects(managed, unmanaged).Build(),
+		Log:      logr.Discard(),
+		Registry: &fakeImageBackupProvider{},
+	}
+
+	expected, _ := r.Registry.DockerConfigJSON()
+	var testSamples = []struct {
+		namespace string
+		data      string
+	}{
+		{namespace: "foo", data: string(expected)},
+		{namespace: "bar", data: "custom"},
+	}
+
+	for _, sample := range testSamples {
+		if err := r.ensurePullSecret(context.Background(), sample.namespace, DefaultPullSecretName); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		s := &corev1.Secret{}
+		if err := r.Get(context.Background(), types.NamespacedName{Namespace: sample.namespace, Name: DefaultPullSecretName}, s); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if got := string(s.Data[corev1.DockerConfigJsonKey]); got != sample.data {
+			t.Errorf("secret data does not match on namespace %s, expected %s got %s", sample.namespace, sample.data, got)
+		}
+	}
+}
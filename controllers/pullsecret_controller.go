@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"time"
+)
+
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;update
+
+// PullSecretReconciler keeps managed backup registry pull secrets in sync with backup registry credentials
+type PullSecretReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Registry registry.DockerRegistry
+
+	events chan event.GenericEvent
+}
+
+// Reconcile updates managed pull secret data on credentials change
+func (r *PullSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	s := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, s); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, fmt.Errorf("unable to get pull secret %s, error %w", req.NamespacedName, err)
+	}
+
+	if !isManagedPullSecret(s) {
+		return ctrl.Result{}, nil
+	}
+
+	data, err := r.Registry.DockerConfigJSON()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if bytes.Equal(s.Data[corev1.DockerConfigJsonKey], data) {
+		return ctrl.Result{}, nil
+	}
+
+	r.Log.Info("Updating backup registry pull secret", "resource", req.NamespacedName)
+	s.Data = map[string][]byte{corev1.DockerConfigJsonKey: data}
+	if err := r.Update(ctx, s); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		if errors.IsConflict(err) {
+			return ctrl.Result{RequeueAfter: time.Second}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// Resync enqueues all managed pull secrets, it is expected to be called on backup registry credentials rotation
+func (r *PullSecretReconciler) Resync(ctx context.Context) error {
+	l := &corev1.SecretList{}
+	if err := r.List(ctx, l, client.MatchingLabels{v1alpha1.ManagedByLabel: v1alpha1.ManagedBy}); err != nil {
+		return fmt.Errorf("unable to list pull secrets, error %w", err)
+	}
+
+	for i := range l.Items {
+		s := &l.Items[i]
+		r.events <- event.GenericEvent{Object: s}
+	}
+
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PullSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	managed := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetLabels()[v1alpha1.ManagedByLabel] == v1alpha1.ManagedBy
+	})
+
+	r.events = make(chan event.GenericEvent)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pullsecret").
+		For(&corev1.Secret{}, builder.WithPredicates(managed, IgnoreDeleteEvents())).
+		Watches(&source.Channel{Source: r.events}, &handler.EnqueueRequestForObject{}).
+		Complete(r)
+}
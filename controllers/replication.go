@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultHealthCheckInterval = time.Minute
+
+// replicate copies backup image to replica destinations, replicas are copied from the source image pinned to the
+// manifest the primary backup was copied from so that every destination holds the same image, destination
+// platform filters may trim it to a different digest
+func (r *ImageBackupReconciler) replicate(ctx context.Context, ib *v1alpha1.ImageBackup, digest string, report func(*v1alpha1.BackupProgress)) error {
+	if ib.Status.CopiedFrom != "" {
+		digest = ib.Status.CopiedFrom
+	}
+
+	src := registry.PinnedImageName(ib.Spec.Image, digest)
+	for _, destination := range ib.Spec.Replicas {
+		newImage, current, err := r.replicateTo(ctx, ib, destination, src, report)
+		if err != nil {
+			recordDestination(ib, v1alpha1.DestinationStatus{Destination: destination, Image: newImage, LastError: err.Error()})
+			return fmt.Errorf("unable to replicate image %s to destination %s, error %w", ib.Spec.Image, destination, err)
+		}
+
+		recordDestination(ib, v1alpha1.DestinationStatus{Destination: destination, Image: newImage, Digest: current, Ready: true, Healthy: true})
+	}
+
+	activate(ib)
+	return nil
+}
+
+// replicateTo copies src image to destination and returns replica image and digest, replicas already holding
+// the recorded destination digest are kept
+func (r *ImageBackupReconciler) replicateTo(ctx context.Context, ib *v1alpha1.ImageBackup, destination, src string, report func(*v1alpha1.BackupProgress)) (string, string, error) {
+	reg, err := destinationRegistry(r.Registry, destination)
+	if err != nil {
+		return "", "", err
+	}
+
+	newImage, err := reg.BackupImageName(ib.Spec.Image)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to build image  %s new name, error %w", ib.Spec.Image, err)
+	}
+
+	recorded := destinationStatus(ib, destination).Digest
+	checkCtx, checkCancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	exists, err := reg.Exists(checkCtx, newImage)
+	if err == nil && !exists {
+		recordDestination(ib, v1alpha1.DestinationStatus{Destination: destination, Image: newImage, CopyStarted: true})
+	}
+
+	if err == nil && exists {
+		var current string
+		current, err = reg.Digest(checkCtx, newImage)
+		exists = recorded != "" && current == recorded
+	}
+	checkCancel()
+	if err != nil {
+		return newImage, "", fmt.Errorf("unable to check image %s existence, error %w", newImage, err)
+	}
+
+	if exists {
+		r.Log.Info("Backup Image replica already exists", "src", src, "dst", newImage)
+		return newImage, recorded, nil
+	}
+
+	r.Log.Info("Creating Backup Image replica", "src", src, "dst", newImage)
+	backupCtx, cancel := context.WithTimeout(ctx, defaultBackupTimeout)
+	defer cancel()
+	startedAt := time.Now()
+	progress := registry.WithProgress(func(p registry.Progress) {
+		report(backupProgress(p, startedAt, time.Now()))
+	})
+	if err := reg.Backup(backupCtx, src, newImage, progress); err != nil {
+		return newImage, "", err
+	}
+
+	current, err := reg.Digest(backupCtx, newImage)
+	if err != nil {
+		return newImage, "", fmt.Errorf("unable to get backup image %s digest, error %w", newImage, err)
+	}
+
+	return newImage, current, nil
+}
+
+// checkDestinations records destinations health and fails over to the first healthy replica while primary
+// destination is unhealthy, it reports if destinations status has changed and if every replica still holds the backup
+func (r *ImageBackupReconciler) checkDestinations(ctx context.Context, ib *v1alpha1.ImageBackup) (changed bool, ready bool) {
+	ready = true
+	for _, destination := range ib.Destinations() {
+		current := destinationStatus(ib, destination)
+		next := v1alpha1.DestinationStatus{Destination: destination, Image: current.Image, Digest: current.Digest, Ready: current.Ready}
+		if next.Image == "" {
+			next.Image, _ = destinationImageName(r.Registry, destination, ib.Spec.Image)
+		}
+
+		digest, err := r.destinationDigest(ctx, destination, next.Image)
+		switch {
+		case err != nil:
+			next.LastError = err.Error()
+		case next.Digest != "" && digest != next.Digest && destination != ib.Spec.Destination:
+			// primary digest mismatch is handled on backup verification
+			next.Healthy = true
+			next.Ready = false
+			next.LastError = "backup image digest does not match " + next.Digest
+			ready = false
+		default:
+			next.Healthy = true
+		}
+
+		if next.Healthy != current.Healthy || next.Ready != current.Ready || next.LastError != current.LastError || next.Image != current.Image {
+			recordDestination(ib, next)
+			changed = true
+		}
+	}
+
+	if active := ib.ActiveDestination(); activate(ib) != active {
+		r.Log.Info("Backup destination failover", "key", ib.Name, "from", active, "to", ib.ActiveDestination())
+		changed = true
+	}
+
+	return changed, ready
+}
+
+func (r *ImageBackupReconciler) destinationDigest(ctx context.Context, destination, image string) (string, error) {
+	reg, err := destinationRegistry(r.Registry, destination)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultExistenceCheckTimeout)
+	defer cancel()
+	return reg.Digest(ctx, image)
+}
+
+func (r *ImageBackupReconciler) healthCheckInterval() time.Duration {
+	if r.HealthCheckInterval <= 0 {
+		return defaultHealthCheckInterval
+	}
+
+	return r.HealthCheckInterval
+}
+
+// destinationStatus returns recorded destination status, zero value if not found
+func destinationStatus(ib *v1alpha1.ImageBackup, destination string) v1alpha1.DestinationStatus {
+	for _, d := range ib.Status.Destinations {
+		if d.Destination == destination {
+			return d
+		}
+	}
+
+	return v1alpha1.DestinationStatus{Destination: destination}
+}
+
+// recordDestination upserts destination status keeping ImageBackup destinations order, active flag is preserved
+func recordDestination(ib *v1alpha1.ImageBackup, d v1alpha1.DestinationStatus) {
+	now := metav1.Now()
+	d.LastCheck = &now
+	d.Active = destinationStatus(ib, d.Destination).Active
+	d.CopyStarted = d.CopyStarted || destinationStatus(ib, d.Destination).CopyStarted
+
+	res := make([]v1alpha1.DestinationStatus, 0, len(ib.Spec.Replicas)+1)
+	for _, destination := range ib.Destinations() {
+		if destination == d.Destination {
+			res = append(res, d)
+			continue
+		}
+
+		for _, s := range ib.Status.Destinations {
+			if s.Destination == destination {
+				res = append(res, s)
+			}
+		}
+	}
+	ib.Status.Destinations = res
+}
+
+// activate flags the primary destination as active if it is ready and healthy, the first ready and healthy
+// replica otherwise, primary destination is kept if none is available
+func activate(ib *v1alpha1.ImageBackup) string {
+	active := ib.Spec.Destination
+	for _, destination := range ib.Destinations() {
+		if d := destinationStatus(ib, destination); d.Ready && d.Healthy {
+			active = destination
+			break
+		}
+	}
+
+	for i := range ib.Status.Destinations {
+		ib.Status.Destinations[i].Active = ib.Status.Destinations[i].Destination == active
+	}
+
+	return active
+}
+
+// failover returns ImageBackup active destination image for consumer containers using another destination image,
+// empty image is returned if container image is up to date
+func (r *GenericReconciler) failover(ctx context.Context, consumer v1alpha1.WorkloadReference, image string) (string, error) {
+	l := &v1alpha1.ImageBackupList{}
+	if err := r.List(ctx, l, client.InNamespace(imageBackupNamespace), client.MatchingFields{v1alpha1.ConsumerField: consumer.Key()}); err != nil {
+		return "", err
+	}
+
+	for i := range l.Items {
+		ib := &l.Items[i]
+		if ib.Status.Phase != v1alpha1.PhaseDone || len(ib.Spec.Replicas) == 0 || !hasConsumer(ib, consumer) {
+			continue
+		}
+
+		if !r.pullable(ib.ActiveDestination()) {
+			return "", nil
+		}
+
+		active, err := r.rewriteImage(ib, ib.ActiveDestination())
+		if err != nil {
+			return "", err
+		}
+
+		if image == active {
+			return "", nil
+		}
+
+		for _, destination := range ib.Destinations() {
+			if img, err := r.rewriteImage(ib, destination); err == nil && img == image {
+				return active, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// rewriteImage returns workload image on ImageBackup destination
+func (r *GenericReconciler) rewriteImage(ib *v1alpha1.ImageBackup, destination string) (string, error) {
+	newImage, err := destinationImageName(r.Registry, destination, ib.Spec.Image)
+	if err != nil {
+		return "", err
+	}
+
+	if r.PinDigest {
+		digest := destinationStatus(ib, destination).Digest
+		if digest == "" {
+			digest = ib.Status.Digest
+		}
+		newImage = registry.PinnedImageName(newImage, digest)
+	}
+
+	return newImage, nil
+}
+
+func hasConsumer(ib *v1alpha1.ImageBackup, consumer v1alpha1.WorkloadReference) bool {
+	for _, c := range ib.Spec.Consumers {
+		if c.Key() == consumer.Key() && c.Container == consumer.Container {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failoverRequests enqueues ImageBackup consumer workloads of gk kind
+func failoverRequests(gk schema.GroupKind) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+		ib, ok := o.(*v1alpha1.ImageBackup)
+		if !ok {
+			return nil
+		}
+
+		var res []reconcile.Request
+		seen := map[types.NamespacedName]bool{}
+		for _, c := range ib.Spec.Consumers {
+			if schema.FromAPIVersionAndKind(c.APIVersion, c.Kind).GroupKind() != gk {
+				continue
+			}
+
+			key := types.NamespacedName{Namespace: c.Namespace, Name: c.Name}
+			if !seen[key] {
+				seen[key] = true
+				res = append(res, reconcile.Request{NamespacedName: key})
+			}
+		}
+
+		return res
+	})
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	"net/http/httptest"
+	"net/url"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"testing"
+)
+
+func TestExecuteReplicatesBackupAndFailsOverOnPrimaryOutage(t *testing.T) {
+	primary := httptest.NewServer(ggcrregistry.New())
+	defer primary.Close()
+	secondary := httptest.NewServer(ggcrregistry.New())
+	defer secondary.Close()
+
+	p, _ := url.Parse(primary.URL)
+	s, _ := url.Parse(secondary.URL)
+	src := s.Host + "/source/nginx:1.14.2"
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	if err := crane.Push(img, src); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	def := registry.NewDockerRegistry(p.Host+"/backup/", "foo", "bar")
+	eu := registry.NewDockerRegistry(s.Host+"/backup/", "foo", "bar")
+	router, err := registry.NewRouter(def, map[string]registry.DockerRegistry{"eu": eu}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	r := &ImageBackupReconciler{Log: logr.Discard(), Registry: router}
+	ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Image: src, Replicas: []string{"eu"}}}
+	digest, err := r.execute(context.Background(), ib, func(*v1alpha1.BackupProgress) {})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := 2, len(ib.Status.Destinations); expected != got {
+		t.Fatalf("destinations do not match, expected %d got %d", expected, got)
+	}
+
+	for _, d := range ib.Status.Destinations {
+		if !d.Ready || !d.Healthy || d.Digest != digest {
+			t.Errorf("unexpected destination %s status %+v", d.Destination, d)
+		}
+	}
+
+	if expected, got := registry.DefaultDestination, ib.ActiveDestination(); expected != got {
+		t.Errorf("active destination does not match, expected %q got %q", expected, got)
+	}
+
+	primary.Close()
+	changed, ready := r.checkDestinations(context.Background(), ib)
+	if !changed || !ready {
+		t.Fatalf("unexpected check result, changed %t ready %t", changed, ready)
+	}
+
+	if expected, got := "eu", ib.ActiveDestination(); expected != got {
+		t.Errorf("active destination does not match, expected %q got %q", expected, got)
+	}
+
+	if d := destinationStatus(ib, registry.DefaultDestination); d.Healthy || d.LastError == "" {
+		t.Errorf("expected unhealthy primary destination, got %+v", d)
+	}
+}
+
+func TestActiveDestinationChangedFiltersFailoverUpdates(t *testing.T) {
+	old := &v1alpha1.ImageBackup{
+		Spec:   v1alpha1.ImageBackupSpec{Replicas: []string{"eu"}},
+		Status: v1alpha1.ImageBackupStatus{Phase: v1alpha1.PhaseDone},
+	}
+	failover := old.DeepCopy()
+	failover.Status.Destinations = []v1alpha1.DestinationStatus{{Destination: ""}, {Destination: "eu", Active: true}}
+
+	pr := ActiveDestinationChanged()
+	if !pr.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: failover}) {
+		t.Error("expected failover update to pass")
+	}
+
+	if pr.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: old.DeepCopy()}) {
+		t.Error("expected update without failover to be filtered")
+	}
+
+	if pr.Create(event.CreateEvent{Object: failover}) {
+		t.Error("expected create events to be filtered")
+	}
+}
+
+func TestRewriteImagePinsDestinationDigest(t *testing.T) {
+	reg, err := registry.NewRouter(
+		registry.NewDockerRegistry("registry.local/backup/", "foo", "bar"),
+		map[string]registry.DockerRegistry{"eu": registry.NewDockerRegistry("eu.registry.local/backup/", "foo", "bar")},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	const primary, replica = "sha256:aaaa", "sha256:bbbb"
+	ib := &v1alpha1.ImageBackup{
+		Spec: v1alpha1.ImageBackupSpec{Image: "nginx:1.21", Replicas: []string{"eu"}},
+		Status: v1alpha1.ImageBackupStatus{
+			Digest:       primary,
+			Destinations: []v1alpha1.DestinationStatus{{Destination: "eu", Digest: replica}},
+		},
+	}
+
+	var testSamples = []struct {
+		pinDigest   bool
+		destination string
+		expected    string
+	}{
+		{pinDigest: false, destination: "", expected: "registry.local/backup/library_nginx:1.21"},
+		{pinDigest: false, destination: "eu", expected: "eu.registry.local/backup/library_nginx:1.21"},
+		{pinDigest: true, destination: "eu", expected: "eu.registry.local/backup/library_nginx:1.21@" + replica},
+		// destinations without recorded digest fall back to the primary backup digest
+		{pinDigest: true, destination: "", expected: "registry.local/backup/library_nginx:1.21@" + primary},
+	}
+
+	for i, sample := range testSamples {
+		r := &GenericReconciler{Registry: reg, PinDigest: sample.pinDigest}
+		got, err := r.rewriteImage(ib, sample.destination)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if sample.expected != got {
+			t.Errorf("sample %d image does not match, expected %s got %s", i, sample.expected, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func TestRetentionResolvesObjectOverControllerPolicy(t *testing.T) {
+	var testSamples = []struct {
+		controller v1alpha1.Retention
+		object     *v1alpha1.Retention
+		policy     string
+		ttl        time.Duration
+	}{
+		{policy: v1alpha1.RetentionTTL, ttl: defaultRetentionTTL},
+		{controller: v1alpha1.Retention{Policy: v1alpha1.RetentionForever}, policy: v1alpha1.RetentionForever, ttl: defaultRetentionTTL},
+		{controller: v1alpha1.Retention{TTL: &metav1.Duration{Duration: time.Hour}}, policy: v1alpha1.RetentionTTL, ttl: time.Hour},
+		{
+			controller: v1alpha1.Retention{Policy: v1alpha1.RetentionForever},
+			object:     &v1alpha1.Retention{Policy: v1alpha1.RetentionWhileReferenced, TTL: &metav1.Duration{Duration: time.Minute}},
+			policy:     v1alpha1.RetentionWhileReferenced,
+			ttl:        time.Minute,
+		},
+	}
+
+	for _, sample := range testSamples {
+		r := &ImageBackupReconciler{Retention: sample.controller}
+		ib := &v1alpha1.ImageBackup{Spec: v1alpha1.ImageBackupSpec{Retention: sample.object}}
+
+		policy, ttl := r.retention(ib)
+		if policy != sample.policy || ttl != sample.ttl {
+			t.Errorf("retention does not match, expected %s/%s got %s/%s", sample.policy, sample.ttl, policy, ttl)
+		}
+	}
+}
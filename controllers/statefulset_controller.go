@@ -0,0 +1,65 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// StatefulSetReconciler reconciles a StatefulSet object
+type StatefulSetReconciler struct {
+	*GenericReconciler
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+}
+
+//+kubebuilder:rbac:groups="";apps,resources=statefulsets,verbs=get;list;update;watch
+//+kubebuilder:rbac:groups=k8slab.io,resources=imagebackups,verbs=create;get;list;update;watch
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *StatefulSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	sts := &appsv1.StatefulSet{}
+	return r.reconcile(ctx, req, sts, StatefulSetPodTemplate)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *StatefulSetReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, ns *NamespaceSelector) error {
+	pr := predicate.And(
+		IgnoreGenericEvents(),
+		SelectedNamespaces(ns),
+		StatefulSetReady(),
+		StatefulSetHasNonBackupImage(fn.IsNonImageBackup),
+	)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&appsv1.StatefulSet{}, builder.WithPredicates(pr)).
+		Watches(&source.Kind{Type: &v1alpha1.ImageBackup{}}, failoverRequests(appsv1.SchemeGroupVersion.WithKind("StatefulSet").GroupKind()), builder.WithPredicates(ActiveDestinationChanged())).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, namespaceRequests(r.Client, ns, func() client.ObjectList { return &appsv1.StatefulSetList{} }, pr), builder.WithPredicates(NamespaceLabelsChanged())).
+		Complete(r)
+}
@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gexec"
@@ -88,6 +89,7 @@ var _ = BeforeSuite(func(done Done) {
 		Log:      ctrl.Log.WithName("controllers").WithName("Repository"),
 		Scheme:   k8sManager.GetScheme(),
 		Registry: &fakeImageBackupProvider{},
+		Resolver: &fakeImageBackupProvider{},
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -119,7 +121,15 @@ func (f *fakeImageBackupProvider) Exists(ctx context.Context, image string) (boo
 	return false, nil
 }
 
-func (f *fakeImageBackupProvider) Backup(ctx context.Context, imageSource, imageDestination string) error {
+func (f *fakeImageBackupProvider) DockerConfigJSON() ([]byte, error) {
+	return []byte(`{"auths":{"index.docker.io":{"username":"fake","password":"fake"}}}`), nil
+}
+
+func (f *fakeImageBackupProvider) Delete(ctx context.Context, image string) error {
+	return nil
+}
+
+func (f *fakeImageBackupProvider) Backup(ctx context.Context, imageSource, imageDestination string, opts ...registry.BackupOption) error {
 	time.Sleep(time.Second * 2)
 	return nil
 }
@@ -127,3 +137,7 @@ func (f *fakeImageBackupProvider) Backup(ctx context.Context, imageSource, image
 func (f *fakeImageBackupProvider) BackupImageName(image string) (string, error) {
 	return "fake-image-name:1.1.1", nil
 }
+
+func (f *fakeImageBackupProvider) Digest(ctx context.Context, image string) (string, error) {
+	return "sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c", nil
+}
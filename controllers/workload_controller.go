@@ -0,0 +1,87 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
+)
+
+// WorkloadReconciler reconciles configured workload kinds as unstructured objects, the
+// manager ClusterRole must grant get;list;update;watch on each configured kind
+type WorkloadReconciler struct {
+	*GenericReconciler
+	client.Client
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	GVK      schema.GroupVersionKind
+	Accessor PodTemplateAccessor
+}
+
+// Reconcile is part of the main kubernetes reconciliation loop which aims to
+// move the current state of the cluster closer to the desired state.
+func (r *WorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconcile(ctx, req, r.newObject(), r.Accessor)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkloadReconciler) SetupWithManager(mgr ctrl.Manager, fn ImagePredicateFilter, ns *NamespaceSelector) error {
+	pr := predicate.And(
+		IgnoreGenericEvents(),
+		SelectedNamespaces(ns),
+		HasNonBackupImage(r.Accessor, fn.IsNonImageBackup),
+	)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(r.controllerName()).
+		For(r.newObject(), builder.WithPredicates(pr)).
+		Watches(&source.Kind{Type: &v1alpha1.ImageBackup{}}, failoverRequests(r.GVK.GroupKind()), builder.WithPredicates(ActiveDestinationChanged())).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, namespaceRequests(r.Client, ns, r.newList, pr), builder.WithPredicates(NamespaceLabelsChanged())).
+		Complete(r)
+}
+
+func (r *WorkloadReconciler) newObject() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(r.GVK)
+	return u
+}
+
+func (r *WorkloadReconciler) newList() client.ObjectList {
+	l := &unstructured.UnstructuredList{}
+	l.SetGroupVersionKind(r.GVK.GroupVersion().WithKind(r.GVK.Kind + "List"))
+	return l
+}
+
+func (r *WorkloadReconciler) controllerName() string {
+	name := strings.ToLower(r.GVK.Kind)
+	if r.GVK.Group == "" {
+		return name
+	}
+
+	return name + "_" + strings.ReplaceAll(r.GVK.Group, ".", "_")
+}
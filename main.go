@@ -17,10 +17,23 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto"
 	"errors"
 	"flag"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/marcosQuesada/image-backup-controller/pkg/config"
+	"github.com/marcosQuesada/image-backup-controller/pkg/executor"
 	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"os"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
@@ -40,13 +53,12 @@ import (
 )
 
 const kubeSystemNamespace = "kube-system"
+const imageBackupNamespace = "image-backup"
 
 var (
 	scheme         = runtime.NewScheme()
 	setupLog       = ctrl.Log.WithName("setup")
 	backupRegistry string
-	username       string
-	token          string
 )
 
 func init() {
@@ -60,11 +72,20 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var configPath string
+	var credentialsSecret string
+	var tokenFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&configPath, "config", "", "The image backup controller configuration file path.")
+	flag.StringVar(&credentialsSecret, "registry-credentials-secret", "",
+		"The backup registry credentials Secret as namespace/name (dockerconfigjson, basic-auth or token). "+
+			"Credentials are rotated on Secret changes.")
+	flag.StringVar(&tokenFile, "registry-token-file", "",
+		"The backup registry bearer token file path, it is read again once modified.")
 
 	opts := zap.Options{
 		Development: true,
@@ -74,6 +95,12 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		setupLog.Error(err, "unable to load configuration")
+		os.Exit(1)
+	}
+
 	syncPeriod := time.Minute * 30
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
@@ -83,25 +110,140 @@ func main() {
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "6d243b47.k8slab.io",
 		SyncPeriod:             &(syncPeriod),
+		// only managed pull secrets are cached, source pull secrets are read from API server
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Secret{}: {Label: labels.SelectorFromSet(labels.Set{k8slabiov1alpha1.ManagedByLabel: k8slabiov1alpha1.ManagedBy})},
+			},
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	bannedNamespaces := []string{kubeSystemNamespace, "ingress-nginx", "image-backup"} // namespace restrictions to allow demo
-	dr := registry.NewDockerRegistry(backupRegistry, username, token)
+	namespaces, err := namespaceSelector(cfg.Namespaces, mgr.GetClient())
+	if err != nil {
+		setupLog.Error(err, "invalid namespace selection")
+		os.Exit(1)
+	}
+	naming, err := registry.NamingStrategyFromName(cfg.NamingStrategy)
+	if err != nil {
+		setupLog.Error(err, "invalid naming strategy")
+		os.Exit(1)
+	}
+
+	platforms, err := registry.ParsePlatforms(cfg.Platforms)
+	if err != nil {
+		setupLog.Error(err, "invalid backup platforms")
+		os.Exit(1)
+	}
+
+	var secret types.NamespacedName
+	var credentials *registry.Credentials
+	var dr registry.DockerRegistry
+	if cfg.Local != nil {
+		dr, err = registry.NewLocalRegistry(registry.DefaultLocalRepository, cfg.Local.Path, cfg.Local.Format, registry.WithNamingStrategy(naming), registry.WithPlatforms(platforms...))
+		if err != nil {
+			setupLog.Error(err, "unable to create local backup store")
+			os.Exit(1)
+		}
+	} else {
+		if backupRegistry == "" {
+			setupLog.Error(errors.New("bad config"), "empty backup registry")
+			os.Exit(1)
+		}
+
+		if credentialsSecret != "" {
+			secret = parseNamespacedName(credentialsSecret)
+		}
+
+		auth, err := backupCredentials(secret, tokenFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load backup registry credentials")
+			os.Exit(1)
+		}
+
+		credentials = registry.NewCredentials(auth)
+		dr = registry.NewDockerRegistry(backupRegistry, "", "", registry.WithNamingStrategy(naming), registry.WithAuthenticator(credentials), registry.WithPlatforms(platforms...), registry.WithArtifacts(cfg.Artifacts...))
+	}
+
+	destinations := map[string]destination{}
+	if len(cfg.Destinations) > 0 {
+		routed := map[string]registry.DockerRegistry{}
+		for _, d := range cfg.Destinations {
+			dst, err := newDestination(d, cfg.Artifacts)
+			if err != nil {
+				setupLog.Error(err, "unable to create backup destination", "destination", d.Name)
+				os.Exit(1)
+			}
+			destinations[d.Name] = dst
+			routed[d.Name] = dst.registry
+		}
+
+		routes := make([]registry.Route, 0, len(cfg.Routes))
+		for _, r := range cfg.Routes {
+			route, err := r.RegistryRoute()
+			if err != nil {
+				setupLog.Error(err, "invalid backup route", "destination", r.Destination)
+				os.Exit(1)
+			}
+			routes = append(routes, route)
+		}
+
+		dr, err = registry.NewRouter(dr, routed, routes)
+		if err != nil {
+			setupLog.Error(err, "unable to create backup router")
+			os.Exit(1)
+		}
+	}
+
+	// source digests are resolved with backup registries credentials, each one scoped to its registry host
+	var keychains []authn.Keychain
+	if credentials != nil {
+		keychains = append(keychains, registry.NewRegistryKeychain(backupRegistry, credentials))
+	}
+	for _, d := range cfg.Destinations {
+		if dst := destinations[d.Name]; dst.credentials != nil {
+			keychains = append(keychains, registry.NewRegistryKeychain(dst.backupRegistry, dst.credentials))
+		}
+	}
+
+	if cfg.PullSecret.Injection != "" && cfg.PullSecret.Injection != k8slabiov1alpha1.PullSecretInjectionNone {
+		if _, err := dr.DockerConfigJSON(); errors.Is(err, registry.ErrTokenPullSecret) {
+			setupLog.Error(err, "pull secret injection requires username and password backup registry credentials")
+			os.Exit(1)
+		}
+	}
+	imagePolicy, err := cfg.ImagePolicy.Policy()
+	if err != nil {
+		setupLog.Error(err, "invalid image policy")
+		os.Exit(1)
+	}
+	filter := controllers.NewPolicyFilter(dr, imagePolicy)
+
 	g := &controllers.GenericReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("generic"),
-		Registry: dr,
+		Client:              mgr.GetClient(),
+		Log:                 ctrl.Log.WithName("controllers").WithName("generic"),
+		Registry:            dr,
+		PinDigest:           cfg.PinDigest,
+		PullSecretInjection: cfg.PullSecret.Injection,
+		PullSecretName:      cfg.PullSecret.Name,
+		Replicas:            cfg.ReplicaSets(),
+		Policy:              imagePolicy,
+		Recorder:            mgr.GetEventRecorderFor("image-backup-controller"),
 	}
+	if err = g.SetupWithManager(context.Background(), mgr); err != nil {
+		setupLog.Error(err, "unable to index image backups")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.DeploymentReconciler{
 		GenericReconciler: g,
 		Client:            mgr.GetClient(),
 		Scheme:            mgr.GetScheme(),
 		Log:               ctrl.Log.WithName("controllers").WithName("deployment"),
-	}).SetupWithManager(mgr, dr, bannedNamespaces); err != nil {
+	}).SetupWithManager(mgr, filter, namespaces); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Deployment")
 		os.Exit(1)
 	}
@@ -111,16 +253,130 @@ func main() {
 		Client:            mgr.GetClient(),
 		Scheme:            mgr.GetScheme(),
 		Log:               ctrl.Log.WithName("controllers").WithName("daemonSet"),
-	}).SetupWithManager(mgr, dr, bannedNamespaces); err != nil {
+	}).SetupWithManager(mgr, filter, namespaces); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DaemonSet")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.ImageBackupReconciler{
+	if err = (&controllers.StatefulSetReconciler{
+		GenericReconciler: g,
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Log:               ctrl.Log.WithName("controllers").WithName("statefulSet"),
+	}).SetupWithManager(mgr, filter, namespaces); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "StatefulSet")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.CronJobReconciler{
+		GenericReconciler: g,
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Log:               ctrl.Log.WithName("controllers").WithName("cronJob"),
+	}).SetupWithManager(mgr, filter, namespaces); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CronJob")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.JobReconciler{
+		GenericReconciler: g,
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Log:               ctrl.Log.WithName("controllers").WithName("job"),
+	}).SetupWithManager(mgr, filter, namespaces); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Job")
+		os.Exit(1)
+	}
+
+	for _, w := range cfg.Workloads {
+		accessor, err := controllers.NewUnstructuredPodTemplate(w.PodTemplatePath)
+		if err != nil {
+			setupLog.Error(err, "invalid pod template path", "controller", w.GroupVersionKind().String())
+			os.Exit(1)
+		}
+
+		if err = (&controllers.WorkloadReconciler{
+			GenericReconciler: g,
+			Client:            mgr.GetClient(),
+			Scheme:            mgr.GetScheme(),
+			Log:               ctrl.Log.WithName("controllers").WithName(w.Kind),
+			GVK:               w.GroupVersionKind(),
+			Accessor:          accessor,
+		}).SetupWithManager(mgr, filter, namespaces); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", w.GroupVersionKind().String())
+			os.Exit(1)
+		}
+	}
+
+	ps := &controllers.PullSecretReconciler{
 		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Log:      ctrl.Log.WithName("controllers").WithName("imageBackup"),
+		Log:      ctrl.Log.WithName("controllers").WithName("pullSecret"),
 		Registry: dr,
+	}
+	if err = ps.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PullSecret")
+		os.Exit(1)
+	}
+
+	if secret.Name != "" {
+		if err := watchCredentials(mgr, "", secret, backupRegistry, credentials, ps.Resync); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Credentials")
+			os.Exit(1)
+		}
+	}
+
+	if credentials != nil && secret.Name == "" && tokenFile != "" {
+		if err := mgr.Add(&controllers.TokenFileWatcher{
+			Log:         ctrl.Log.WithName("controllers").WithName("token-file"),
+			Credentials: credentials,
+			OnRotate:    ps.Resync,
+		}); err != nil {
+			setupLog.Error(err, "unable to create token file watcher")
+			os.Exit(1)
+		}
+	}
+
+	for name, d := range destinations {
+		if d.secret.Name == "" {
+			continue
+		}
+
+		if err := watchCredentials(mgr, name, d.secret, d.backupRegistry, d.credentials, ps.Resync); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Credentials", "destination", name)
+			os.Exit(1)
+		}
+	}
+
+	var verifier registry.Verifier
+	if cfg.SignatureVerification != nil {
+		keys, err := signatureKeys(*cfg.SignatureVerification)
+		if err != nil {
+			setupLog.Error(err, "unable to load signature verification public keys")
+			os.Exit(1)
+		}
+		verifier = registry.NewSignatureVerifier(keys...)
+	}
+
+	if err = (&controllers.ImageBackupReconciler{
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		Log:                 ctrl.Log.WithName("controllers").WithName("imageBackup"),
+		Registry:            dr,
+		APIReader:           mgr.GetAPIReader(),
+		RefreshPolicy:       cfg.RefreshPolicy,
+		RefreshInterval:     cfg.RefreshInterval.Duration,
+		MaxRetries:          cfg.MaxRetries,
+		RetryBackoff:        cfg.RetryBackoff.Duration,
+		Retention:           cfg.Retention,
+		CleanupAborted:      cfg.CleanupAbortedBackups,
+		HealthCheckInterval: cfg.HealthCheckInterval.Duration,
+		Verifier:            verifier,
+		Resolver:            registry.NewSourceResolver(authn.NewMultiKeychain(keychains...)),
+		Executor: executor.New(ctrl.Log.WithName("executor"),
+			executor.WithWorkers(cfg.Executor.Workers),
+			executor.WithQueueSize(cfg.Executor.QueueSize),
+			executor.WithPerRegistryLimit(cfg.Executor.PerRegistryLimit),
+		),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ImageBackup")
 		os.Exit(1)
@@ -145,27 +401,179 @@ func main() {
 }
 
 func init() {
-	errBadConfig := errors.New("bad config")
-	reg := os.Getenv("BACKUP_REPOSITORY")
-	if reg == "" {
-		setupLog.Error(errBadConfig, "empty backup registry")
-		os.Exit(1)
+	// backup registry is required unless backups are stored locally
+	backupRegistry = os.Getenv("BACKUP_REPOSITORY")
+}
+
+// backupCredentials loads backup registry initial credentials from Secret, token file or environment variables
+func backupCredentials(secret types.NamespacedName, tokenFile string) (authn.Authenticator, error) {
+	if secret.Name != "" {
+		return secretCredentials(secret, backupRegistry)
+	}
+
+	if tokenFile != "" {
+		a := registry.NewTokenFileAuthenticator(tokenFile)
+		if _, err := a.Authorization(); err != nil {
+			return nil, err
+		}
+
+		return a, nil
 	}
-	backupRegistry = reg
 
 	u := os.Getenv("BACKUP_REPOSITORY_USERNAME")
 	if u == "" {
-		setupLog.Error(errBadConfig, "empty registry username")
-		os.Exit(1)
+		return nil, errors.New("empty registry username")
 	}
 
-	username = u
-
 	pass := os.Getenv("BACKUP_REPOSITORY_PASSWORD")
 	if pass == "" {
-		setupLog.Error(errBadConfig, "empty backup password")
-		os.Exit(1)
+		return nil, errors.New("empty backup password")
+	}
+
+	return authn.FromConfig(authn.AuthConfig{Username: u, Password: pass}), nil
+}
+
+// secretCredentials loads registry credentials from Secret
+func secretCredentials(secret types.NamespacedName, reg string) (authn.Authenticator, error) {
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &corev1.Secret{}
+	if err := c.Get(context.Background(), secret, s); err != nil {
+		return nil, fmt.Errorf("unable to get credentials secret %s, error %w", secret, err)
+	}
+
+	return registry.AuthenticatorFromSecret(s, reg)
+}
+
+// signatureKeys loads signature verification public keys from Secret or ConfigMap
+func signatureKeys(v config.SignatureVerification) ([]crypto.PublicKey, error) {
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	if v.PublicKeysSecret != "" {
+		s := &corev1.Secret{}
+		if err := c.Get(context.Background(), parseNamespacedName(v.PublicKeysSecret), s); err != nil {
+			return nil, fmt.Errorf("unable to get public keys secret %s, error %w", v.PublicKeysSecret, err)
+		}
+
+		return registry.ParsePublicKeys(s.Data)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(context.Background(), parseNamespacedName(v.PublicKeysConfigMap), cm); err != nil {
+		return nil, fmt.Errorf("unable to get public keys configmap %s, error %w", v.PublicKeysConfigMap, err)
+	}
+
+	data := map[string][]byte{}
+	for k, v := range cm.Data {
+		data[k] = []byte(v)
+	}
+
+	return registry.ParsePublicKeys(data)
+}
+
+// destination is a routed backup registry along with its rotated credentials
+type destination struct {
+	backupRegistry string
+	registry       registry.DockerRegistry
+	credentials    *registry.Credentials
+	secret         types.NamespacedName
+}
+
+// newDestination builds destination registry or local store, destinations without credentials Secret pull anonymously.
+// Artifacts are copied to registry destinations only
+func newDestination(d config.Destination, artifacts []string) (destination, error) {
+	naming, err := registry.NamingStrategyFromName(d.NamingStrategy)
+	if err != nil {
+		return destination{}, err
+	}
+
+	platforms, err := registry.ParsePlatforms(d.Platforms)
+	if err != nil {
+		return destination{}, err
+	}
+
+	if d.Local != nil {
+		reg, err := registry.NewLocalRegistry(registry.DefaultLocalRepository+d.Name+"/", d.Local.Path, d.Local.Format, registry.WithNamingStrategy(naming), registry.WithPlatforms(platforms...))
+		return destination{registry: reg}, err
+	}
+
+	res := destination{backupRegistry: d.Registry}
+	auth := authn.Anonymous
+	if d.CredentialsSecret != "" {
+		res.secret = parseNamespacedName(d.CredentialsSecret)
+		auth, err = secretCredentials(res.secret, d.Registry)
+		if err != nil {
+			return destination{}, err
+		}
+	}
+
+	res.credentials = registry.NewCredentials(auth)
+	res.registry = registry.NewDockerRegistry(d.Registry, "", "", registry.WithNamingStrategy(naming), registry.WithAuthenticator(res.credentials), registry.WithPlatforms(platforms...), registry.WithArtifacts(artifacts...))
+	return res, nil
+}
+
+// watchCredentials rotates registry credentials on Secret changes, Secret is watched from a cache restricted to it
+func watchCredentials(mgr ctrl.Manager, name string, secret types.NamespacedName, reg string, credentials *registry.Credentials, onRotate func(ctx context.Context) error) error {
+	secretCache, err := cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: secret.Namespace,
+		SelectorsByObject: cache.SelectorsByObject{
+			&corev1.Secret{}: {Field: fields.OneTermEqualSelector("metadata.name", secret.Name)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create credentials secret cache, error %w", err)
+	}
+
+	if err := mgr.Add(secretCache); err != nil {
+		return fmt.Errorf("unable to add credentials secret cache, error %w", err)
+	}
+
+	return (&controllers.CredentialsReconciler{
+		Name:           name,
+		Reader:         secretCache,
+		Log:            ctrl.Log.WithName("controllers").WithName("credentials"),
+		Secret:         secret,
+		BackupRegistry: reg,
+		Credentials:    credentials,
+		OnRotate:       onRotate,
+	}).SetupWithManager(mgr, secretCache)
+}
+
+// namespaceSelector builds workload namespaces selector, system namespaces are excluded if selection is not
+// defined and controller namespace is always excluded
+func namespaceSelector(n config.NamespaceSelection, c client.Reader) (*controllers.NamespaceSelector, error) {
+	selector, err := n.LabelSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := append([]string{imageBackupNamespace}, n.Exclude...)
+	if n.IsZero() {
+		exclude = append(exclude, kubeSystemNamespace, "ingress-nginx")
+	}
+
+	return &controllers.NamespaceSelector{
+		Include:  n.Include,
+		Exclude:  exclude,
+		Selector: selector,
+		Reader:   c,
+	}, nil
+}
+
+// parseNamespacedName parses namespace/name, namespace defaults to image backup namespace
+func parseNamespacedName(value string) types.NamespacedName {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) == 1 {
+		return types.NamespacedName{Namespace: imageBackupNamespace, Name: parts[0]}
 	}
 
-	token = pass
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}
 }
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"fmt"
+	"github.com/marcosQuesada/image-backup-controller/api/v1alpha1"
+	"github.com/marcosQuesada/image-backup-controller/pkg/policy"
+	"github.com/marcosQuesada/image-backup-controller/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"os"
+	"path"
+	"regexp"
+	"sigs.k8s.io/yaml"
+)
+
+// Config defines image backup controller configuration
+type Config struct {
+	NamingStrategy        string             `json:"namingStrategy,omitempty"`
+	PinDigest             bool               `json:"pinDigest,omitempty"`
+	RefreshPolicy         string             `json:"refreshPolicy,omitempty"`
+	RefreshInterval       metav1.Duration    `json:"refreshInterval,omitempty"`
+	MaxRetries            int32              `json:"maxRetries,omitempty"`
+	RetryBackoff          metav1.Duration    `json:"retryBackoff,omitempty"`
+	Retention             v1alpha1.Retention `json:"retention,omitempty"`
+	Executor              Executor           `json:"executor,omitempty"`
+	CleanupAbortedBackups bool               `json:"cleanupAbortedBackups,omitempty"`
+	PullSecret            PullSecret         `json:"pullSecret,omitempty"`
+	Workloads             []Workload         `json:"workloads,omitempty"`
+	Destinations          []Destination      `json:"destinations,omitempty"`
+	Routes                []Route            `json:"routes,omitempty"`
+	Replicas              []string           `json:"replicas,omitempty"`
+	HealthCheckInterval   metav1.Duration    `json:"healthCheckInterval,omitempty"`
+	Local                 *Local             `json:"local,omitempty"`
+	Platforms             []string           `json:"platforms,omitempty"`
+	Artifacts             []string           `json:"artifacts,omitempty"`
+	// SignatureVerification gates backups on source image signatures, signatures are not verified if empty
+	SignatureVerification *SignatureVerification `json:"signatureVerification,omitempty"`
+	ImagePolicy           ImagePolicy            `json:"imagePolicy,omitempty"`
+	Namespaces            NamespaceSelection     `json:"namespaces,omitempty"`
+}
+
+// NamespaceSelection defines reconciled workload namespaces, Include and Exclude are glob patterns and Selector
+// matches namespace labels. Empty Include selects any namespace, exclusions win over inclusions
+type NamespaceSelection struct {
+	Include  []string              `json:"include,omitempty"`
+	Exclude  []string              `json:"exclude,omitempty"`
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// IsZero reports if namespace selection is not defined
+func (n NamespaceSelection) IsZero() bool {
+	return len(n.Include) == 0 && len(n.Exclude) == 0 && n.Selector == nil
+}
+
+// LabelSelector returns namespace labels selector, everything is selected if empty
+func (n NamespaceSelection) LabelSelector() (labels.Selector, error) {
+	if n.Selector == nil {
+		return labels.Everything(), nil
+	}
+
+	return metav1.LabelSelectorAsSelector(n.Selector)
+}
+
+// ImagePolicy defines which images are backed up, rules are evaluated in order and unmatched images get the
+// default action. Actions are one of Allow (default), Deny or Skip
+type ImagePolicy struct {
+	DefaultAction string       `json:"defaultAction,omitempty"`
+	Rules         []PolicyRule `json:"rules,omitempty"`
+}
+
+// PolicyRule matches images by registry, repository and tag glob patterns, empty patterns match any value
+type PolicyRule struct {
+	Name         string   `json:"name,omitempty"`
+	Action       string   `json:"action"`
+	Registries   []string `json:"registries,omitempty"`
+	Repositories []string `json:"repositories,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+}
+
+// Policy builds image policy from its definition
+func (p ImagePolicy) Policy() (*policy.Policy, error) {
+	rules := make([]policy.Rule, 0, len(p.Rules))
+	for i, r := range p.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+
+		rules = append(rules, policy.Rule{
+			Name:         name,
+			Action:       r.Action,
+			Registries:   r.Registries,
+			Repositories: r.Repositories,
+			Tags:         r.Tags,
+		})
+	}
+
+	return policy.New(p.DefaultAction, rules...)
+}
+
+// SignatureVerification defines source image signature verification before backup, PEM public keys or
+// certificates are read from a Secret or a ConfigMap referenced as namespace/name
+type SignatureVerification struct {
+	PublicKeysSecret    string `json:"publicKeysSecret,omitempty"`
+	PublicKeysConfigMap string `json:"publicKeysConfigMap,omitempty"`
+}
+
+// Local defines a filesystem backup store, Format is one of OCILayout (default) or Tarball
+type Local struct {
+	Path   string `json:"path"`
+	Format string `json:"format,omitempty"`
+}
+
+func (l *Local) tarball() bool {
+	return l != nil && l.Format == registry.LocalFormatTarball
+}
+
+// Destination defines a named backup registry or local store, registry credentials Secret is referenced as
+// namespace/name
+type Destination struct {
+	Name              string `json:"name"`
+	Registry          string `json:"registry,omitempty"`
+	Local             *Local `json:"local,omitempty"`
+	NamingStrategy    string `json:"namingStrategy,omitempty"`
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// Replicas are the destinations its backups are replicated to
+	Replicas []string `json:"replicas,omitempty"`
+	// Platforms trim copied image indexes to os/arch[/variant] platforms, all platforms are copied if empty
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// Route selects workload images backup destination, routes are evaluated in order and empty matchers match any
+// value, unmatched images are backed up on the default destination
+type Route struct {
+	Destination       string                `json:"destination"`
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	Images            []string              `json:"images,omitempty"`
+	ImageRegex        string                `json:"imageRegex,omitempty"`
+}
+
+// RegistryRoute builds registry route from its definition
+func (r Route) RegistryRoute() (registry.Route, error) {
+	route := registry.Route{
+		Destination: r.Destination,
+		Namespaces:  r.Namespaces,
+		Images:      r.Images,
+	}
+
+	if r.NamespaceSelector != nil {
+		sel, err := metav1.LabelSelectorAsSelector(r.NamespaceSelector)
+		if err != nil {
+			return registry.Route{}, fmt.Errorf("invalid namespace selector, error %w", err)
+		}
+		route.NamespaceSelector = sel
+	}
+
+	if r.ImageRegex != "" {
+		re, err := regexp.Compile(r.ImageRegex)
+		if err != nil {
+			return registry.Route{}, fmt.Errorf("invalid image regex, error %w", err)
+		}
+		route.ImageRegex = re
+	}
+
+	return route, nil
+}
+
+// Executor defines backup executor parallelism, zero values fall back to executor defaults
+type Executor struct {
+	Workers          int `json:"workers,omitempty"`
+	QueueSize        int `json:"queueSize,omitempty"`
+	PerRegistryLimit int `json:"perRegistryLimit,omitempty"`
+}
+
+// PullSecret defines backup registry pull secret injection on rewritten workloads, Injection is one of None,
+// PodTemplate or ServiceAccount
+type PullSecret struct {
+	Injection string `json:"injection,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Workload defines an extra workload kind to be watched, its pod template is located by a JSONPath field expression
+type Workload struct {
+	Group           string `json:"group,omitempty"`
+	Version         string `json:"version"`
+	Kind            string `json:"kind"`
+	PodTemplatePath string `json:"podTemplatePath"`
+}
+
+// GroupVersionKind returns workload GVK
+func (w Workload) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: w.Group, Version: w.Version, Kind: w.Kind}
+}
+
+// ReplicaSets returns replica destinations by primary destination
+func (c *Config) ReplicaSets() map[string][]string {
+	res := map[string][]string{}
+	if len(c.Replicas) > 0 {
+		res[registry.DefaultDestination] = c.Replicas
+	}
+
+	for _, d := range c.Destinations {
+		if len(d.Replicas) > 0 {
+			res[d.Name] = d.Replicas
+		}
+	}
+
+	return res
+}
+
+// Load reads configuration from file path, empty path returns default configuration
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s, error %w", path, err)
+	}
+
+	if err := yaml.UnmarshalStrict(raw, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s, error %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks configuration consistency
+func (c *Config) Validate() error {
+	switch c.RefreshPolicy {
+	case "", v1alpha1.RefreshPolicyNever, v1alpha1.RefreshPolicyAlways:
+	case v1alpha1.RefreshPolicyScheduled:
+		if c.RefreshInterval.Duration <= 0 {
+			return fmt.Errorf("refresh policy %s requires refreshInterval", c.RefreshPolicy)
+		}
+	default:
+		return fmt.Errorf("unknown refresh policy %s", c.RefreshPolicy)
+	}
+
+	switch c.Retention.Policy {
+	case "", v1alpha1.RetentionForever, v1alpha1.RetentionTTL, v1alpha1.RetentionWhileReferenced:
+	default:
+		return fmt.Errorf("unknown retention policy %s", c.Retention.Policy)
+	}
+
+	if c.Retention.TTL != nil && c.Retention.TTL.Duration < 0 {
+		return fmt.Errorf("retention ttl must not be negative")
+	}
+
+	if c.Executor.Workers < 0 || c.Executor.QueueSize < 0 || c.Executor.PerRegistryLimit < 0 {
+		return fmt.Errorf("executor workers, queueSize and perRegistryLimit must not be negative")
+	}
+
+	switch c.PullSecret.Injection {
+	case "", v1alpha1.PullSecretInjectionNone, v1alpha1.PullSecretInjectionPodTemplate, v1alpha1.PullSecretInjectionServiceAccount:
+	default:
+		return fmt.Errorf("unknown pull secret injection %s", c.PullSecret.Injection)
+	}
+
+	for i, w := range c.Workloads {
+		if w.Version == "" || w.Kind == "" {
+			return fmt.Errorf("workload %d requires version and kind", i)
+		}
+
+		if w.PodTemplatePath == "" {
+			return fmt.Errorf("workload %s requires podTemplatePath", w.GroupVersionKind())
+		}
+	}
+
+	if v := c.SignatureVerification; v != nil && (v.PublicKeysSecret == "") == (v.PublicKeysConfigMap == "") {
+		return fmt.Errorf("signature verification requires either publicKeysSecret or publicKeysConfigMap")
+	}
+
+	if _, err := c.ImagePolicy.Policy(); err != nil {
+		return fmt.Errorf("invalid image policy, %w", err)
+	}
+
+	for _, p := range append(append([]string{}, c.Namespaces.Include...), c.Namespaces.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q, error %w", p, err)
+		}
+	}
+
+	if _, err := c.Namespaces.LabelSelector(); err != nil {
+		return fmt.Errorf("invalid namespace selector, %w", err)
+	}
+
+	for _, a := range c.Artifacts {
+		if !registry.IsArtifactKind(a) {
+			return fmt.Errorf("unknown artifact kind %s", a)
+		}
+	}
+
+	if err := validateLocal(c.Local); err != nil {
+		return err
+	}
+
+	if err := validatePlatforms(c.Local, c.Platforms); err != nil {
+		return err
+	}
+
+	destinations := map[string]bool{}
+	tarballs := map[string]bool{registry.DefaultDestination: c.Local.tarball()}
+	for i, d := range c.Destinations {
+		if d.Name == "" || (d.Registry == "") == (d.Local == nil) {
+			return fmt.Errorf("destination %d requires name and either registry or local", i)
+		}
+
+		if err := validateLocal(d.Local); err != nil {
+			return fmt.Errorf("destination %s %w", d.Name, err)
+		}
+
+		if err := validatePlatforms(d.Local, d.Platforms); err != nil {
+			return fmt.Errorf("destination %s %w", d.Name, err)
+		}
+		tarballs[d.Name] = d.Local.tarball()
+
+		if destinations[d.Name] {
+			return fmt.Errorf("duplicated destination %s", d.Name)
+		}
+		destinations[d.Name] = true
+	}
+
+	if err := validateReplicas(destinations, tarballs, registry.DefaultDestination, c.Replicas); err != nil {
+		return err
+	}
+
+	for _, d := range c.Destinations {
+		if err := validateReplicas(destinations, tarballs, d.Name, d.Replicas); err != nil {
+			return err
+		}
+	}
+
+	if c.HealthCheckInterval.Duration < 0 {
+		return fmt.Errorf("health check interval must not be negative")
+	}
+
+	for i, r := range c.Routes {
+		if !destinations[r.Destination] {
+			return fmt.Errorf("route %d destination %q not found", i, r.Destination)
+		}
+
+		if _, err := r.RegistryRoute(); err != nil {
+			return fmt.Errorf("route %d %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateReplicas checks replica destinations, tarball stores do not keep manifest digests so that they can not
+// be replicated
+func validateReplicas(destinations, tarballs map[string]bool, destination string, replicas []string) error {
+	seen := map[string]bool{}
+	for _, r := range replicas {
+		if tarballs[destination] || tarballs[r] {
+			return fmt.Errorf("destination %q replica %q, tarball stores can not be replicated", destination, r)
+		}
+
+		if !destinations[r] {
+			return fmt.Errorf("destination %q replica %q not found", destination, r)
+		}
+
+		if r == destination || seen[r] {
+			return fmt.Errorf("destination %q replica %q duplicated", destination, r)
+		}
+		seen[r] = true
+	}
+
+	return nil
+}
+
+// validatePlatforms checks platform filters, tarball stores hold a single image so that one platform is allowed
+func validatePlatforms(l *Local, platforms []string) error {
+	if _, err := registry.ParsePlatforms(platforms); err != nil {
+		return err
+	}
+
+	if l.tarball() && len(platforms) > 1 {
+		return fmt.Errorf("tarball store accepts a single platform")
+	}
+
+	return nil
+}
+
+func validateLocal(l *Local) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.Path == "" {
+		return fmt.Errorf("local store requires path")
+	}
+
+	switch l.Format {
+	case "", registry.LocalFormatOCILayout, registry.LocalFormatTarball:
+	default:
+		return fmt.Errorf("unknown local store format %s", l.Format)
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	raw := `
+workloads:
+- group: k8slab.io
+  version: v1
+  kind: Worker
+  podTemplatePath: "{.spec.template}"
+`
+	if err := os.WriteFile(path, []byte(raw), 0600); err != nil {
+		t.Fatalf("unable to write config file, error %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := 1, len(cfg.Workloads); expected != got {
+		t.Fatalf("workloads do not match, expected %d got %d", expected, got)
+	}
+
+	if expected, got := "k8slab.io/v1, Kind=Worker", cfg.Workloads[0].GroupVersionKind().String(); expected != got {
+		t.Errorf("gvk does not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestLoadEmptyPathReturnsDefaultConfig(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(cfg.Workloads) != 0 {
+		t.Errorf("unexpected workloads %v", cfg.Workloads)
+	}
+}
+
+func TestLoadConfigWithoutPodTemplatePathFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	raw := `
+workloads:
+- version: v1
+  kind: Worker
+`
+	if err := os.WriteFile(path, []byte(raw), 0600); err != nil {
+		t.Fatalf("unable to write config file, error %v", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLoadConfigWithScheduledRefreshPolicyRequiresInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("refreshPolicy: Scheduled\n"), 0600); err != nil {
+		t.Fatalf("unable to write config file, error %v", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := os.WriteFile(path, []byte("refreshPolicy: Scheduled\nrefreshInterval: 1h\n"), 0600); err != nil {
+		t.Fatalf("unable to write config file, error %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := "1h0m0s", cfg.RefreshInterval.Duration.String(); expected != got {
+		t.Errorf("refresh interval does not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestLoadConfigWithUnknownRetentionPolicyFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("retention:\n  policy: Sometimes\n"), 0600); err != nil {
+		t.Fatalf("unable to write config file, error %v", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := os.WriteFile(path, []byte("retention:\n  policy: WhileReferenced\n  ttl: 24h\n"), 0600); err != nil {
+		t.Fatalf("unable to write config file, error %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := "24h0m0s", cfg.Retention.TTL.Duration.String(); expected != got {
+		t.Errorf("retention ttl does not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestLoadConfigValidatesDestinations(t *testing.T) {
+	var testSamples = []struct {
+		raw   string
+		valid bool
+	}{
+		{
+			raw: `
+destinations:
+- name: eu
+  registry: eu.gcr.io/backup/
+routes:
+- destination: eu
+  namespaces: ["team-eu-*"]
+  namespaceSelector:
+    matchLabels:
+      region: eu
+  imageRegex: "^ghcr\\.io/"
+`,
+			valid: true,
+		},
+		{
+			raw: `
+routes:
+- destination: eu
+`,
+			valid: false,
+		},
+		{
+			raw: `
+destinations:
+- name: eu
+  registry: eu.gcr.io/backup/
+routes:
+- destination: eu
+  imageRegex: "("
+`,
+			valid: false,
+		},
+		{
+			raw: `
+replicas: [eu]
+destinations:
+- name: eu
+  registry: eu.gcr.io/backup/
+  replicas: [us]
+- name: us
+  registry: us.gcr.io/backup/
+`,
+			valid: true,
+		},
+		{
+			raw: `
+destinations:
+- name: eu
+  registry: eu.gcr.io/backup/
+  replicas: [eu]
+`,
+			valid: false,
+		},
+		{
+			raw: `
+replicas: [us]
+`,
+			valid: false,
+		},
+		{
+			raw: `
+local:
+  path: /var/lib/image-backup
+destinations:
+- name: edge
+  local:
+    path: /mnt/backup
+    format: Tarball
+`,
+			valid: true,
+		},
+		{
+			raw: `
+destinations:
+- name: edge
+  registry: eu.gcr.io/backup/
+  local:
+    path: /mnt/backup
+`,
+			valid: false,
+		},
+		{
+			raw: `
+replicas: [edge]
+destinations:
+- name: edge
+  local:
+    path: /mnt/backup
+    format: Tarball
+`,
+			valid: false,
+		},
+		{
+			raw: `
+platforms: [linux/amd64, linux/arm64/v8]
+destinations:
+- name: edge
+  local:
+    path: /mnt/backup
+    format: Tarball
+  platforms: [linux/arm64]
+`,
+			valid: true,
+		},
+		{
+			raw: `
+platforms: [linux]
+`,
+			valid: false,
+		},
+		{
+			raw: `
+destinations:
+- name: edge
+  local:
+    path: /mnt/backup
+    format: Tarball
+  platforms: [linux/amd64, linux/arm64]
+`,
+			valid: false,
+		},
+		{
+			raw: `
+artifacts: [Signature, Attestation, SBOM]
+`,
+			valid: true,
+		},
+		{
+			raw: `
+artifacts: [Provenance]
+`,
+			valid: false,
+		},
+		{
+			raw: `
+signatureVerification:
+  publicKeysConfigMap: image-backup/cosign-keys
+`,
+			valid: true,
+		},
+		{
+			raw: `
+signatureVerification:
+  publicKeysSecret: image-backup/cosign-keys
+  publicKeysConfigMap: image-backup/cosign-keys
+`,
+			valid: false,
+		},
+		{
+			raw: `
+imagePolicy:
+  defaultAction: Deny
+  rules:
+  - name: internal
+    action: Skip
+    registries: [registry.internal.example.com]
+  - action: Deny
+    tags: [latest]
+  - action: Allow
+    registries: [index.docker.io, ghcr.io]
+`,
+			valid: true,
+		},
+		{
+			raw: `
+imagePolicy:
+  rules:
+  - action: Block
+`,
+			valid: false,
+		},
+		{
+			raw: `
+namespaces:
+  include: [team-*]
+  exclude: [team-sandbox]
+  selector:
+    matchLabels:
+      image-backup.k8slab.io/enabled: "true"
+`,
+			valid: true,
+		},
+		{
+			raw: `
+namespaces:
+  exclude: ["["]
+`,
+			valid: false,
+		},
+		{
+			raw: `
+namespaces:
+  selector:
+    matchExpressions:
+    - key: image-backup.k8slab.io/enabled
+      operator: Maybe
+`,
+			valid: false,
+		},
+	}
+
+	for i, sample := range testSamples {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(sample.raw), 0600); err != nil {
+			t.Fatalf("unable to write config file, error %v", err)
+		}
+
+		_, err := Load(path)
+		if expected, got := sample.valid, err == nil; expected != got {
+			t.Errorf("sample %d validation does not match, expected %t got %t error %v", i, expected, got, err)
+		}
+	}
+}
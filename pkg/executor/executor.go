@@ -0,0 +1,322 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"sync"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultQueueSize   = 100
+	defaultPerRegistry = 2
+)
+
+// ErrQueueFull is returned when no more jobs can be queued
+var ErrQueueFull = errors.New("executor queue is full")
+
+const (
+	// StateQueued jobs are waiting for a free worker or registry slot
+	StateQueued = "Queued"
+	// StateRunning jobs are being executed
+	StateRunning = "Running"
+	// StateDone jobs are completed, its result is kept until forgotten
+	StateDone = "Done"
+)
+
+// ReportFunc records running job progress
+type ReportFunc func(progress interface{})
+
+// Job defines a unit of work identified by key, jobs sharing registry are limited by per registry concurrency
+type Job struct {
+	Key      string
+	Registry string
+	Run      func(ctx context.Context, report ReportFunc) (interface{}, error)
+	// Done is called once job is completed, it must not block
+	Done func()
+}
+
+// Result describes job execution state
+type Result struct {
+	State    string
+	Progress interface{}
+	Value    interface{}
+	Err      error
+}
+
+type job struct {
+	Job
+	result    Result
+	ctx       context.Context
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Executor runs jobs on a bounded worker pool, jobs are queued and dispatched as soon as a worker and
+// a registry slot are available. Executor runs on the elected leader only, on leadership loss its context
+// is cancelled aborting running jobs, queued and running jobs are lost so that they are submitted again
+// by the new leader
+type Executor struct {
+	workers     int
+	queueSize   int
+	perRegistry int
+	log         logr.Logger
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	pending []*job
+	jobs    map[string]*job
+	active  map[string]int
+}
+
+// Option configures executor
+type Option func(*Executor)
+
+// WithWorkers defines worker pool size, 4 by default
+func WithWorkers(n int) Option {
+	return func(e *Executor) {
+		if n > 0 {
+			e.workers = n
+		}
+	}
+}
+
+// WithQueueSize defines max queued jobs, 100 by default
+func WithQueueSize(n int) Option {
+	return func(e *Executor) {
+		if n > 0 {
+			e.queueSize = n
+		}
+	}
+}
+
+// WithPerRegistryLimit defines max running jobs per registry, 2 by default
+func WithPerRegistryLimit(n int) Option {
+	return func(e *Executor) {
+		if n > 0 {
+			e.perRegistry = n
+		}
+	}
+}
+
+// New instantiates executor
+func New(log logr.Logger, opts ...Option) *Executor {
+	e := &Executor{
+		workers:     defaultWorkers,
+		queueSize:   defaultQueueSize,
+		perRegistry: defaultPerRegistry,
+		log:         log,
+		jobs:        map[string]*job{},
+		active:      map[string]int{},
+	}
+	e.cond = sync.NewCond(&e.mutex)
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Submit queues job, jobs already known by key are ignored so that submission is idempotent
+func (e *Executor) Submit(j Job) error {
+	if j.Key == "" || j.Run == nil {
+		return fmt.Errorf("invalid job %q", j.Key)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.jobs[j.Key]; ok {
+		return nil
+	}
+
+	if len(e.pending) >= e.queueSize {
+		return ErrQueueFull
+	}
+
+	jb := &job{Job: j, result: Result{State: StateQueued}}
+	e.jobs[j.Key] = jb
+	e.pending = append(e.pending, jb)
+	queuedJobs.Set(float64(len(e.pending)))
+	e.cond.Signal()
+
+	return nil
+}
+
+// Result returns job state by key
+func (e *Executor) Result(key string) (Result, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	j, ok := e.jobs[key]
+	if !ok {
+		return Result{}, false
+	}
+
+	return j.result, true
+}
+
+// Forget removes completed job result, queued and running jobs are kept
+func (e *Executor) Forget(key string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if j, ok := e.jobs[key]; ok && j.result.State == StateDone {
+		delete(e.jobs, key)
+	}
+}
+
+// Cancel aborts job by key, queued jobs are removed and running jobs context is cancelled, its result is kept
+// until forgotten once its execution is stopped. It reports if job was queued or running
+func (e *Executor) Cancel(key string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	j, ok := e.jobs[key]
+	if !ok || j.result.State == StateDone {
+		return false
+	}
+
+	if j.result.State == StateQueued {
+		for i, p := range e.pending {
+			if p == j {
+				e.pending = append(e.pending[:i], e.pending[i+1:]...)
+				break
+			}
+		}
+		queuedJobs.Set(float64(len(e.pending)))
+		delete(e.jobs, key)
+		return true
+	}
+
+	j.cancelled = true
+	j.cancel()
+	return true
+}
+
+// Start runs worker pool until context is cancelled, it implements manager Runnable
+func (e *Executor) Start(ctx context.Context) error {
+	e.log.Info("Starting executor", "workers", e.workers, "queueSize", e.queueSize, "perRegistry", e.perRegistry)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < e.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.worker(ctx)
+		}()
+	}
+
+	<-ctx.Done()
+	e.mutex.Lock()
+	e.cond.Broadcast()
+	e.mutex.Unlock()
+	wg.Wait()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for key, j := range e.jobs {
+		if j.result.State != StateDone {
+			delete(e.jobs, key)
+		}
+	}
+	e.pending = nil
+
+	e.log.Info("Executor stopped")
+	return nil
+}
+
+// NeedLeaderElection runs executor on the elected leader only
+func (e *Executor) NeedLeaderElection() bool {
+	return true
+}
+
+func (e *Executor) worker(ctx context.Context) {
+	for {
+		j := e.next(ctx)
+		if j == nil {
+			return
+		}
+
+		e.run(ctx, j)
+	}
+}
+
+// next blocks until a job is ready to run, nil is returned on context cancellation
+func (e *Executor) next(ctx context.Context) *job {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		for i, j := range e.pending {
+			if e.active[j.Registry] >= e.perRegistry {
+				continue
+			}
+
+			e.pending = append(e.pending[:i], e.pending[i+1:]...)
+			e.active[j.Registry]++
+			j.result.State = StateRunning
+			j.ctx, j.cancel = context.WithCancel(ctx)
+			queuedJobs.Set(float64(len(e.pending)))
+			runningJobs.Inc()
+			return j
+		}
+
+		e.cond.Wait()
+	}
+}
+
+func (e *Executor) run(ctx context.Context, j *job) {
+	value, err := e.runJob(j)
+
+	e.mutex.Lock()
+	e.active[j.Registry]--
+	if e.active[j.Registry] <= 0 {
+		delete(e.active, j.Registry)
+	}
+	j.cancel()
+	j.result = Result{State: StateDone, Progress: j.result.Progress, Value: value, Err: err}
+	runningJobs.Dec()
+	e.cond.Broadcast()
+	e.mutex.Unlock()
+
+	if ctx.Err() != nil {
+		// aborted on shutdown, result is discarded on Start exit
+		return
+	}
+
+	if j.cancelled {
+		cancelledJobs.Inc()
+	} else if err != nil {
+		failedJobs.Inc()
+	}
+	completedJobs.Inc()
+
+	if j.Done != nil {
+		j.Done()
+	}
+}
+
+// runJob executes job Run, panics are recovered and reported as job failures
+func (e *Executor) runJob(j *job) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.log.Error(fmt.Errorf("%v", r), "job panic", "key", j.Key)
+			value, err = nil, fmt.Errorf("job %s panic: %v", j.Key, r)
+		}
+	}()
+
+	return j.Run(j.ctx, func(progress interface{}) {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+
+		j.result.Progress = progress
+	})
+}
@@ -0,0 +1,220 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitIsIdempotentByKey(t *testing.T) {
+	e := New(logr.Discard(), WithQueueSize(1))
+	j := Job{Key: "foo", Run: func(ctx context.Context, report ReportFunc) (interface{}, error) { return nil, nil }}
+
+	if err := e.Submit(j); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := e.Submit(j); err != nil {
+		t.Fatalf("unexpected error on duplicated submission %v", err)
+	}
+
+	if err := e.Submit(Job{Key: "bar", Run: j.Run}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected queue full error, got %v", err)
+	}
+
+	res, ok := e.Result("foo")
+	if !ok {
+		t.Fatal("job not found")
+	}
+
+	if expected, got := StateQueued, res.State; expected != got {
+		t.Errorf("state does not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestExecutorRunsJobsAndKeepsResultsUntilForgotten(t *testing.T) {
+	e := New(logr.Discard(), WithWorkers(2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Start(ctx)
+
+	done := make(chan struct{})
+	err := e.Submit(Job{
+		Key: "foo",
+		Run: func(ctx context.Context, report ReportFunc) (interface{}, error) {
+			report(50)
+			return "sha256:foo", nil
+		},
+		Done: func() { close(done) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job not completed")
+	}
+
+	res, ok := e.Result("foo")
+	if !ok || res.State != StateDone || res.Value != "sha256:foo" || res.Progress != 50 || res.Err != nil {
+		t.Fatalf("unexpected result %v", res)
+	}
+
+	e.Forget("foo")
+	if _, ok := e.Result("foo"); ok {
+		t.Error("expected forgotten result")
+	}
+}
+
+func TestExecutorLimitsRunningJobsPerRegistry(t *testing.T) {
+	e := New(logr.Discard(), WithWorkers(4), WithPerRegistryLimit(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Start(ctx)
+
+	var running, max int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		err := e.Submit(Job{
+			Key:      fmt.Sprintf("job-%d", i),
+			Registry: "index.docker.io",
+			Run: func(ctx context.Context, report ReportFunc) (interface{}, error) {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 10)
+				atomic.AddInt32(&running, -1)
+				return nil, nil
+			},
+			Done: wg.Done,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	wg.Wait()
+
+	if expected, got := int32(1), atomic.LoadInt32(&max); expected != got {
+		t.Errorf("concurrent jobs per registry do not match, expected %d got %d", expected, got)
+	}
+}
+
+func TestCancelAbortsRunningJobAndReleasesItsSlot(t *testing.T) {
+	e := New(logr.Discard(), WithWorkers(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Start(ctx)
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	err := e.Submit(Job{
+		Key: "foo",
+		Run: func(ctx context.Context, report ReportFunc) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		Done: func() { close(done) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	queued := Job{Key: "bar", Run: func(ctx context.Context, report ReportFunc) (interface{}, error) { return "bar", nil }}
+	if err := e.Submit(queued); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	<-started
+	if !e.Cancel("bar") {
+		t.Fatal("expected queued job cancellation")
+	}
+
+	if _, ok := e.Result("bar"); ok {
+		t.Error("expected queued job removal")
+	}
+
+	if !e.Cancel("foo") {
+		t.Fatal("expected running job cancellation")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job not cancelled")
+	}
+
+	// cancelled job result is kept until forgotten
+	res, ok := e.Result("foo")
+	if !ok || res.State != StateDone || res.Err == nil {
+		t.Errorf("unexpected cancelled job result %+v", res)
+	}
+
+	if e.Cancel("foo") {
+		t.Error("unexpected cancellation of completed job")
+	}
+
+	e.Forget("foo")
+	if _, ok := e.Result("foo"); ok {
+		t.Error("expected cancelled job removal")
+	}
+}
+
+func TestPanickingJobIsReportedAsFailed(t *testing.T) {
+	e := New(logr.Discard(), WithWorkers(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Start(ctx)
+
+	done := make(chan struct{})
+	err := e.Submit(Job{
+		Key:  "foo",
+		Run:  func(ctx context.Context, report ReportFunc) (interface{}, error) { panic("boom") },
+		Done: func() { close(done) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job not completed")
+	}
+
+	res, ok := e.Result("foo")
+	if !ok || res.State != StateDone || res.Err == nil {
+		t.Fatalf("unexpected panicking job result %+v", res)
+	}
+
+	// worker keeps running jobs after a panic
+	if err := e.Submit(Job{Key: "bar", Run: func(ctx context.Context, report ReportFunc) (interface{}, error) { return "bar", nil }}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for i := 0; ; i++ {
+		if res, ok := e.Result("bar"); ok && res.State == StateDone {
+			if expected, got := "bar", res.Value; expected != got {
+				t.Errorf("result does not match, expected %v got %v", expected, got)
+			}
+			break
+		}
+
+		if i == 100 {
+			t.Fatal("job not executed after panic")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,38 @@
+package executor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	queuedJobs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "image_backup_executor_queued_jobs",
+		Help: "The number of jobs waiting for a free executor worker",
+	})
+
+	runningJobs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "image_backup_executor_running_jobs",
+		Help: "The number of jobs being executed",
+	})
+
+	completedJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_backup_executor_completed_jobs_total",
+		Help: "The total number of completed jobs",
+	})
+
+	failedJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_backup_executor_failed_jobs_total",
+		Help: "The total number of completed jobs with error result",
+	})
+
+	cancelledJobs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "image_backup_executor_cancelled_jobs_total",
+		Help: "The total number of running jobs cancelled",
+	})
+)
+
+func init() {
+	// Register custom metrics with the global prometheus registry
+	metrics.Registry.MustRegister(queuedJobs, runningJobs, completedJobs, failedJobs, cancelledJobs)
+}
@@ -0,0 +1,119 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/name"
+	"path"
+)
+
+const (
+	// ActionAllow images are backed up
+	ActionAllow = "Allow"
+	// ActionDeny images are refused, refusals are reported on its workloads
+	ActionDeny = "Deny"
+	// ActionSkip images are silently ignored
+	ActionSkip = "Skip"
+)
+
+// Rule matches images by registry, repository and tag glob patterns, empty patterns match any value. Docker Hub
+// images are matched as index.docker.io registry and library/ prefixed repositories, untagged images as latest tag
+type Rule struct {
+	Name         string
+	Action       string
+	Registries   []string
+	Repositories []string
+	Tags         []string
+}
+
+// Decision is an image policy evaluation result
+type Decision struct {
+	Action string
+	// Rule is the matching rule name, empty if default action applies
+	Rule string
+}
+
+// Allowed reports if image must be backed up
+func (d Decision) Allowed() bool {
+	return d.Action == ActionAllow
+}
+
+// Policy evaluates image rules in order, first matching rule wins
+type Policy struct {
+	defaultAction string
+	rules         []Rule
+}
+
+// New instantiates an image policy, default action is Allow if empty
+func New(defaultAction string, rules ...Rule) (*Policy, error) {
+	if defaultAction == "" {
+		defaultAction = ActionAllow
+	}
+
+	if err := validateAction(defaultAction); err != nil {
+		return nil, err
+	}
+
+	for i, r := range rules {
+		if err := validateAction(r.Action); err != nil {
+			return nil, fmt.Errorf("rule %d %w", i, err)
+		}
+
+		for _, patterns := range [][]string{r.Registries, r.Repositories, r.Tags} {
+			for _, p := range patterns {
+				if _, err := path.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("rule %d invalid pattern %q, error %w", i, p, err)
+				}
+			}
+		}
+	}
+
+	return &Policy{defaultAction: defaultAction, rules: rules}, nil
+}
+
+func validateAction(action string) error {
+	switch action {
+	case ActionAllow, ActionDeny, ActionSkip:
+		return nil
+	}
+
+	return fmt.Errorf("unknown policy action %q", action)
+}
+
+// Evaluate returns image decision, nil policies allow any image and unparseable images get the default action
+func (p *Policy) Evaluate(image string) Decision {
+	if p == nil {
+		return Decision{Action: ActionAllow}
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return Decision{Action: p.defaultAction}
+	}
+
+	var tag string
+	if t, ok := ref.(name.Tag); ok {
+		tag = t.TagStr()
+	}
+
+	for _, r := range p.rules {
+		if matchAny(r.Registries, ref.Context().RegistryStr()) && matchAny(r.Repositories, ref.Context().RepositoryStr()) && matchAny(r.Tags, tag) {
+			return Decision{Action: r.Action, Rule: r.Name}
+		}
+	}
+
+	return Decision{Action: p.defaultAction}
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestPolicyEvaluatesRulesInOrder(t *testing.T) {
+	p, err := New(ActionDeny,
+		Rule{Name: "internal", Action: ActionSkip, Registries: []string{"registry.internal.example.com"}},
+		Rule{Name: "no-latest", Action: ActionDeny, Tags: []string{"latest"}},
+		Rule{Name: "upstreams", Action: ActionAllow, Registries: []string{"index.docker.io", "ghcr.io"}},
+		Rule{Name: "quay-team", Action: ActionAllow, Registries: []string{"quay.io"}, Repositories: []string{"team/*"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var testSamples = []struct {
+		image  string
+		action string
+		rule   string
+	}{
+		{image: "registry.internal.example.com/app:1.0.0", action: ActionSkip, rule: "internal"},
+		{image: "nginx", action: ActionDeny, rule: "no-latest"},
+		{image: "ghcr.io/foo/bar:latest", action: ActionDeny, rule: "no-latest"},
+		{image: "nginx:1.14.2", action: ActionAllow, rule: "upstreams"},
+		{image: "docker.io/library/nginx:1.14.2", action: ActionAllow, rule: "upstreams"},
+		{image: "quay.io/team/app:1.0.0", action: ActionAllow, rule: "quay-team"},
+		{image: "quay.io/other/app:1.0.0", action: ActionDeny, rule: ""},
+		{image: "gcr.io/foo/bar@sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c", action: ActionDeny, rule: ""},
+	}
+
+	for _, sample := range testSamples {
+		d := p.Evaluate(sample.image)
+		if d.Action != sample.action || d.Rule != sample.rule {
+			t.Errorf("decision does not match on %s, expected %s/%s got %s/%s", sample.image, sample.action, sample.rule, d.Action, d.Rule)
+		}
+	}
+}
+
+func TestNilPolicyAllowsAnyImage(t *testing.T) {
+	var p *Policy
+	if !p.Evaluate("nginx:latest").Allowed() {
+		t.Error("expected allowed image")
+	}
+}
+
+func TestNewPolicyValidatesActionsAndPatterns(t *testing.T) {
+	if _, err := New("Block"); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := New("", Rule{Action: ActionAllow, Tags: []string{"["}}); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := New("", Rule{Action: "Maybe"}); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,372 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Artifact kinds copied alongside backup images
+const (
+	ArtifactSignature   = "Signature"
+	ArtifactAttestation = "Attestation"
+	ArtifactSBOM        = "SBOM"
+)
+
+// cosignTagSuffixes are cosign tag based artifacts conventions, artifacts are tagged as sha256-<hex>.<suffix>
+var cosignTagSuffixes = []struct {
+	suffix string
+	kind   string
+}{
+	{suffix: ".sig", kind: ArtifactSignature},
+	{suffix: ".att", kind: ArtifactAttestation},
+	{suffix: ".sbom", kind: ArtifactSBOM},
+}
+
+// IsArtifactKind checks if kind is a known artifact kind
+func IsArtifactKind(kind string) bool {
+	switch kind {
+	case ArtifactSignature, ArtifactAttestation, ArtifactSBOM:
+		return true
+	}
+
+	return false
+}
+
+// Artifact describes an artifact copied alongside a backup image
+type Artifact struct {
+	Kind string
+	// Subject is the backup manifest digest the artifact refers to
+	Subject string
+	// Digest is the artifact manifest digest
+	Digest string
+	// Reference is the artifact reference on backup registry
+	Reference string
+}
+
+// ArtifactFunc receives copied artifacts
+type ArtifactFunc func(Artifact)
+
+// WithArtifacts copies artifacts of the given kinds alongside backup images, both cosign tag conventions and OCI
+// referrers are discovered
+func WithArtifacts(kinds ...string) Option {
+	return func(d *dockerRegistry) {
+		d.artifacts = kinds
+	}
+}
+
+// WithArtifactReport receives artifacts copied alongside backup image
+func WithArtifactReport(fn ArtifactFunc) BackupOption {
+	return func(o *backupOptions) {
+		o.artifacts = fn
+	}
+}
+
+// referrersIndex is an OCI referrers index, descriptors artifact type is not supported by v1.Descriptor
+type referrersIndex struct {
+	SchemaVersion int64           `json:"schemaVersion"`
+	MediaType     types.MediaType `json:"mediaType,omitempty"`
+	Manifests     []referrer      `json:"manifests"`
+}
+
+type referrer struct {
+	MediaType    types.MediaType   `json:"mediaType"`
+	Size         int64             `json:"size"`
+	Digest       v1.Hash           `json:"digest"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// rawManifest implements remote.Taggable on top of raw manifests
+type rawManifest struct {
+	raw       []byte
+	mediaType types.MediaType
+}
+
+// RawManifest returns raw manifest
+func (r rawManifest) RawManifest() ([]byte, error) {
+	return r.raw, nil
+}
+
+// MediaType returns raw manifest media type
+func (r rawManifest) MediaType() (types.MediaType, error) {
+	return r.mediaType, nil
+}
+
+// copyArtifacts copies source artifacts referring to any backup manifest, backup index manifests included so
+// that platform trimmed indexes keep its per platform signatures
+func (d *dockerRegistry) copyArtifacts(ctx context.Context, imageSource, imageDestination string, fn ArtifactFunc) error {
+	srcRef, err := name.ParseReference(imageSource)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	dstRef, err := name.ParseReference(imageDestination)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	srcAuth, err := d.keychain(ctx, imageSource).Resolve(srcRef.Context())
+	if err != nil {
+		return fmt.Errorf("unable to resolve source credentials, error %w", err)
+	}
+
+	srcOpts := []remote.Option{remote.WithContext(ctx), remote.WithAuth(srcAuth)}
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithAuth(d.credentials)}
+	subjects, err := manifestDigests(dstRef, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, subject := range subjects {
+		for _, c := range cosignTagSuffixes {
+			if !d.copiesArtifact(c.kind) {
+				continue
+			}
+
+			tag := digestTag(subject) + c.suffix
+			digest, err := copyManifest(srcRef.Context().Tag(tag), dstRef.Context().Tag(tag), srcOpts, opts)
+			if err != nil {
+				return fmt.Errorf("unable to copy %s artifact %s, error %w", c.kind, tag, err)
+			}
+
+			if digest != "" && fn != nil {
+				fn(Artifact{Kind: c.kind, Subject: subject, Digest: digest, Reference: dstRef.Context().Tag(tag).String()})
+			}
+		}
+
+		if err := d.copyReferrers(ctx, srcRef.Context(), dstRef.Context(), srcAuth, subject, srcOpts, opts, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyReferrers copies subject OCI referrers, destination referrers tag schema index is updated when destination
+// registry does not support referrers API
+func (d *dockerRegistry) copyReferrers(ctx context.Context, src, dst name.Repository, srcAuth authn.Authenticator, subject string, srcOpts, opts []remote.Option, fn ArtifactFunc) error {
+	idx, err := listReferrers(ctx, src, srcAuth, subject, srcOpts)
+	if err != nil {
+		return fmt.Errorf("unable to list %s referrers, error %w", subject, err)
+	}
+
+	var copied []referrer
+	for _, r := range idx.Manifests {
+		kind := artifactKind(r.ArtifactType)
+		if !d.copiesArtifact(kind) {
+			continue
+		}
+
+		if _, err := copyManifest(src.Digest(r.Digest.String()), dst.Digest(r.Digest.String()), srcOpts, opts); err != nil {
+			return fmt.Errorf("unable to copy %s referrer %s, error %w", kind, r.Digest, err)
+		}
+		copied = append(copied, r)
+
+		if fn != nil {
+			fn(Artifact{Kind: kind, Subject: subject, Digest: r.Digest.String(), Reference: dst.Digest(r.Digest.String()).String()})
+		}
+	}
+
+	if len(copied) == 0 {
+		return nil
+	}
+
+	if _, supported, err := referrersAPI(ctx, dst, d.credentials, subject); err != nil || supported {
+		return err
+	}
+
+	current, err := referrersTag(dst, subject, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range copied {
+		if !current.contains(r.Digest) {
+			current.Manifests = append(current.Manifests, r)
+		}
+	}
+
+	raw, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	if err := remote.Put(dst.Tag(digestTag(subject)), rawManifest{raw: raw, mediaType: types.OCIImageIndex}, opts...); err != nil {
+		return fmt.Errorf("unable to update %s referrers tag, error %w", subject, err)
+	}
+
+	return nil
+}
+
+func (d *dockerRegistry) copiesArtifact(kind string) bool {
+	for _, k := range d.artifacts {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// manifestDigests returns image manifest digest followed by its index manifests digests
+func manifestDigests(ref name.Reference, opts []remote.Option) ([]string, error) {
+	desc, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get image %q, error %w", ref, err)
+	}
+
+	res := []string{desc.Digest.String()}
+	if !desc.MediaType.IsIndex() {
+		return res, nil
+	}
+
+	m, err := v1.ParseIndexManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range m.Manifests {
+		res = append(res, child.Digest.String())
+	}
+
+	return res, nil
+}
+
+// copyManifest copies image or index manifest returning its digest, empty digest is returned if source is not found
+func copyManifest(src, dst name.Reference, srcOpts, opts []remote.Option) (string, error) {
+	desc, err := remote.Get(src, srcOpts...)
+	if isNotFound(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return "", err
+		}
+
+		return desc.Digest.String(), remote.WriteIndex(dst, idx, opts...)
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest.String(), remote.Write(dst, img, opts...)
+}
+
+// listReferrers lists subject referrers from referrers API, falling back to referrers tag schema
+func listReferrers(ctx context.Context, repo name.Repository, auth authn.Authenticator, subject string, opts []remote.Option) (*referrersIndex, error) {
+	idx, supported, err := referrersAPI(ctx, repo, auth, subject)
+	if err != nil || supported {
+		return idx, err
+	}
+
+	return referrersTag(repo, subject, opts)
+}
+
+// referrersAPI requests subject referrers, registries not supporting referrers API are reported as unsupported
+func referrersAPI(ctx context.Context, repo name.Repository, auth authn.Authenticator, subject string) (*referrersIndex, bool, error) {
+	t, err := transport.NewWithContext(ctx, repo.Registry, auth, http.DefaultTransport, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, false, err
+	}
+
+	u := url.URL{
+		Scheme: repo.Registry.Scheme(),
+		Host:   repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/referrers/%s", repo.RepositoryStr(), subject),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := (&http.Client{Transport: t}).Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusMethodNotAllowed:
+		return nil, false, nil
+	default:
+		return nil, false, transport.CheckError(resp, http.StatusOK)
+	}
+
+	idx := &referrersIndex{}
+	if err := json.NewDecoder(resp.Body).Decode(idx); err != nil {
+		return nil, false, fmt.Errorf("unable to decode referrers response, error %w", err)
+	}
+
+	return idx, true, nil
+}
+
+// referrersTag returns subject referrers tag schema index, an empty index is returned if not found
+func referrersTag(repo name.Repository, subject string, opts []remote.Option) (*referrersIndex, error) {
+	empty := &referrersIndex{SchemaVersion: 2, MediaType: types.OCIImageIndex}
+	desc, err := remote.Get(repo.Tag(digestTag(subject)), opts...)
+	if isNotFound(err) {
+		return empty, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s referrers tag, error %w", subject, err)
+	}
+
+	if err := json.Unmarshal(desc.Manifest, empty); err != nil {
+		return nil, fmt.Errorf("unable to decode %s referrers tag, error %w", subject, err)
+	}
+
+	return empty, nil
+}
+
+// digestTag returns sha256-<hex> digest tag, used by both cosign and referrers tag schema conventions
+func digestTag(subject string) string {
+	return strings.Replace(subject, ":", "-", 1)
+}
+
+func (r *referrersIndex) contains(digest v1.Hash) bool {
+	for _, m := range r.Manifests {
+		if m.Digest == digest {
+			return true
+		}
+	}
+
+	return false
+}
+
+// artifactKind classifies referrer artifact types, unknown artifact types are never copied
+func artifactKind(artifactType string) string {
+	switch {
+	case strings.HasPrefix(artifactType, "application/vnd.dev.cosign.artifact.sig"),
+		strings.HasPrefix(artifactType, "application/vnd.cncf.notary.signature"):
+		return ArtifactSignature
+	case strings.Contains(artifactType, "in-toto"), strings.Contains(artifactType, "dsse"):
+		return ArtifactAttestation
+	case strings.Contains(artifactType, "spdx"), strings.Contains(artifactType, "cyclonedx"),
+		strings.HasPrefix(artifactType, "application/vnd.dev.cosign.artifact.sbom"):
+		return ArtifactSBOM
+	}
+
+	return ""
+}
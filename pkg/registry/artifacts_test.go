@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDockerRegistryBackupCopiesCosignTagArtifacts(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+	dst := fmt.Sprintf("%s/backupregistry/nginx:1.14.2", u.Host)
+	digest := pushRandomImage(t, src)
+
+	tag := strings.Replace(digest.String(), ":", "-", 1)
+	pushRandomImage(t, fmt.Sprintf("%s/marcosquesada/nginx:%s.sig", u.Host, tag))
+	pushRandomImage(t, fmt.Sprintf("%s/marcosquesada/nginx:%s.sbom", u.Host, tag))
+
+	var artifacts []Artifact
+	r := NewDockerRegistry(u.Host+"/backupregistry/", "foo", "bar", WithArtifacts(ArtifactSignature))
+	if err := r.Backup(context.Background(), src, dst, WithArtifactReport(func(a Artifact) { artifacts = append(artifacts, a) })); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(artifacts) != 1 || artifacts[0].Kind != ArtifactSignature || artifacts[0].Subject != digest.String() {
+		t.Fatalf("unexpected copied artifacts %+v", artifacts)
+	}
+
+	if _, err := crane.Digest(fmt.Sprintf("%s/backupregistry/nginx:%s.sig", u.Host, tag)); err != nil {
+		t.Errorf("signature not copied, error %v", err)
+	}
+
+	if _, err := crane.Digest(fmt.Sprintf("%s/backupregistry/nginx:%s.sbom", u.Host, tag)); err == nil {
+		t.Error("unexpected sbom copy")
+	}
+}
+
+func TestDockerRegistryBackupCopiesReferrersAndUpdatesReferrersTag(t *testing.T) {
+	referrers := map[string][]byte{}
+	reg := registry.New()
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if i := strings.Index(r.URL.Path, "/referrers/"); i >= 0 {
+			w.Header().Set("Content-Type", string(types.OCIImageIndex))
+			_, _ = w.Write(referrers[r.URL.Path[i+len("/referrers/"):]])
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer source.Close()
+
+	destination := httptest.NewServer(registry.New())
+	defer destination.Close()
+
+	su, _ := url.Parse(source.URL)
+	du, _ := url.Parse(destination.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", su.Host)
+	dst := fmt.Sprintf("%s/backupregistry/nginx:1.14.2", du.Host)
+	digest := pushRandomImage(t, src)
+
+	sig := pushRandomImage(t, fmt.Sprintf("%s/marcosquesada/nginx:sig", su.Host))
+	sbom := pushRandomImage(t, fmt.Sprintf("%s/marcosquesada/nginx:sbom", su.Host))
+	referrers[digest.String()], _ = json.Marshal(referrersIndex{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests: []referrer{
+			{MediaType: types.OCIManifestSchema1, Digest: sig, ArtifactType: "application/vnd.cncf.notary.signature"},
+			{MediaType: types.OCIManifestSchema1, Digest: sbom, ArtifactType: "application/spdx+json"},
+		},
+	})
+
+	var artifacts []Artifact
+	r := NewDockerRegistry(du.Host+"/backupregistry/", "foo", "bar", WithArtifacts(ArtifactSignature))
+	if err := r.Backup(context.Background(), src, dst, WithArtifactReport(func(a Artifact) { artifacts = append(artifacts, a) })); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(artifacts) != 1 || artifacts[0].Digest != sig.String() {
+		t.Fatalf("unexpected copied artifacts %+v", artifacts)
+	}
+
+	repo, _ := name.NewRepository(du.Host + "/backupregistry/nginx")
+	idx, err := referrersTag(repo, digest.String(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(idx.Manifests) != 1 || idx.Manifests[0].Digest != sig || idx.Manifests[0].ArtifactType != "application/vnd.cncf.notary.signature" {
+		t.Errorf("unexpected referrers tag index %+v", idx)
+	}
+}
+
+func TestArtifactKindClassification(t *testing.T) {
+	var testSamples = []struct {
+		artifactType string
+		expected     string
+	}{
+		{artifactType: "application/vnd.dev.cosign.artifact.sig.v1+json", expected: ArtifactSignature},
+		{artifactType: "application/vnd.cncf.notary.signature", expected: ArtifactSignature},
+		{artifactType: "application/vnd.in-toto+json", expected: ArtifactAttestation},
+		{artifactType: "application/vnd.dsse.envelope.v1+json", expected: ArtifactAttestation},
+		{artifactType: "application/spdx+json", expected: ArtifactSBOM},
+		{artifactType: "application/vnd.cyclonedx+json", expected: ArtifactSBOM},
+		{artifactType: "application/vnd.example.unknown", expected: ""},
+	}
+
+	for _, sample := range testSamples {
+		if expected, got := sample.expected, artifactKind(sample.artifactType); expected != got {
+			t.Errorf("kind does not match on %s, expected %s got %s", sample.artifactType, expected, got)
+		}
+	}
+}
+
+func pushRandomImage(t *testing.T, image string) v1.Hash {
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("unable to create image, error %v", err)
+	}
+
+	if err := crane.Push(img, image); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unable to get image digest, error %v", err)
+	}
+
+	return digest
+}
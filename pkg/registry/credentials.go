@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSecretKey is the Secret key holding a registry bearer token
+const TokenSecretKey = "token"
+
+// Credentials is a swappable authenticator, rotated credentials are used from the next registry request
+type Credentials struct {
+	mutex sync.RWMutex
+	auth  authn.Authenticator
+}
+
+// NewCredentials instantiates swappable credentials
+func NewCredentials(auth authn.Authenticator) *Credentials {
+	return &Credentials{auth: auth}
+}
+
+// Authorization returns current credentials authorization
+func (c *Credentials) Authorization() (*authn.AuthConfig, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.auth.Authorization()
+}
+
+// Set swaps credentials authenticator, it reports if authorization has changed
+func (c *Credentials) Set(auth authn.Authenticator) (bool, error) {
+	next, err := auth.Authorization()
+	if err != nil {
+		return false, fmt.Errorf("unable to get credentials authorization, error %w", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	prev, err := c.auth.Authorization()
+	c.auth = auth
+
+	return err != nil || *prev != *next, nil
+}
+
+type tokenFile struct {
+	path    string
+	mutex   sync.Mutex
+	modTime time.Time
+	token   string
+}
+
+// NewTokenFileAuthenticator authenticates with a bearer token read from file, the file is read again once
+// modified so that refreshed tokens are picked up without restarts
+func NewTokenFileAuthenticator(path string) authn.Authenticator {
+	return &tokenFile{path: path}
+}
+
+// Authorization returns file bearer token
+func (t *tokenFile) Authorization() (*authn.AuthConfig, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to stat token file %s, error %w", t.path, err)
+	}
+
+	if !info.ModTime().Equal(t.modTime) || t.token == "" {
+		raw, err := os.ReadFile(t.path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read token file %s, error %w", t.path, err)
+		}
+		t.token = strings.TrimSpace(string(raw))
+		t.modTime = info.ModTime()
+	}
+
+	return &authn.AuthConfig{RegistryToken: t.token}, nil
+}
+
+// AuthenticatorFromSecret builds backup registry authenticator from a dockerconfigjson, basic-auth (or any Secret
+// with username and password keys) or bearer token Secret, dockerconfigjson entries are matched against backup registry
+func AuthenticatorFromSecret(s *corev1.Secret, backupRegistry string) (authn.Authenticator, error) {
+	switch {
+	case s.Type == corev1.SecretTypeDockerConfigJson || s.Type == corev1.SecretTypeDockercfg:
+		kc, err := NewPullSecretKeychain([]corev1.Secret{*s})
+		if err != nil {
+			return nil, err
+		}
+
+		ref, err := name.ParseReference(backupRegistry + "credentials")
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse backup registry %s, error %w", backupRegistry, err)
+		}
+
+		auth, err := kc.Resolve(ref.Context())
+		if err != nil {
+			return nil, err
+		}
+
+		if auth == authn.Anonymous {
+			return nil, fmt.Errorf("secret %s/%s has no credentials for %s", s.Namespace, s.Name, ref.Context().RegistryStr())
+		}
+
+		return auth, nil
+	case s.Type == corev1.SecretTypeBasicAuth || len(s.Data[corev1.BasicAuthUsernameKey]) > 0:
+		return authn.FromConfig(authn.AuthConfig{
+			Username: string(s.Data[corev1.BasicAuthUsernameKey]),
+			Password: string(s.Data[corev1.BasicAuthPasswordKey]),
+		}), nil
+	case len(s.Data[TokenSecretKey]) > 0:
+		return authn.FromConfig(authn.AuthConfig{RegistryToken: strings.TrimSpace(string(s.Data[TokenSecretKey]))}), nil
+	default:
+		return nil, fmt.Errorf("secret %s/%s type %s has no supported credentials", s.Namespace, s.Name, s.Type)
+	}
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	corev1 "k8s.io/api/core/v1"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthenticatorFromSecret(t *testing.T) {
+	var testSamples = []struct {
+		secret   corev1.Secret
+		expected authn.AuthConfig
+		err      bool
+	}{
+		{
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"https://index.docker.io/v1/":{"username":"hub","password":"hubToken"}}}`)},
+			},
+			expected: authn.AuthConfig{Username: "hub", Password: "hubToken"},
+		},
+		{
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"ghcr.io":{"username":"ghcr","password":"ghcrToken"}}}`)},
+			},
+			err: true,
+		},
+		{
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeBasicAuth,
+				Data: map[string][]byte{corev1.BasicAuthUsernameKey: []byte("user"), corev1.BasicAuthPasswordKey: []byte("pass")},
+			},
+			expected: authn.AuthConfig{Username: "user", Password: "pass"},
+		},
+		{
+			secret: corev1.Secret{
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{TokenSecretKey: []byte("bearer\n")},
+			},
+			expected: authn.AuthConfig{RegistryToken: "bearer"},
+		},
+		{
+			secret: corev1.Secret{Type: corev1.SecretTypeOpaque},
+			err:    true,
+		},
+	}
+
+	for i, sample := range testSamples {
+		a, err := AuthenticatorFromSecret(&sample.secret, "docker.io/backupregistry/")
+		if sample.err {
+			if err == nil {
+				t.Errorf("expected error on sample %d", i)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error %v on sample %d", err, i)
+		}
+
+		cfg, _ := a.Authorization()
+		if *cfg != sample.expected {
+			t.Errorf("credentials do not match on sample %d, expected %+v got %+v", i, sample.expected, *cfg)
+		}
+	}
+}
+
+func TestCredentialsReportRotation(t *testing.T) {
+	c := NewCredentials(authn.FromConfig(authn.AuthConfig{Username: "user", Password: "foo"}))
+
+	changed, err := c.Set(authn.FromConfig(authn.AuthConfig{Username: "user", Password: "foo"}))
+	if err != nil || changed {
+		t.Fatalf("unexpected rotation, changed %t error %v", changed, err)
+	}
+
+	changed, err = c.Set(authn.FromConfig(authn.AuthConfig{Username: "user", Password: "bar"}))
+	if err != nil || !changed {
+		t.Fatalf("expected rotation, changed %t error %v", changed, err)
+	}
+
+	cfg, _ := c.Authorization()
+	if expected, got := "bar", cfg.Password; expected != got {
+		t.Errorf("password does not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestTokenFileAuthenticatorReadsRefreshedTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("foo\n"), 0600); err != nil {
+		t.Fatalf("unable to write token file, error %v", err)
+	}
+
+	a := NewTokenFileAuthenticator(path)
+	cfg, err := a.Authorization()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := "foo", cfg.RegistryToken; expected != got {
+		t.Errorf("token does not match, expected %s got %s", expected, got)
+	}
+
+	if err := os.WriteFile(path, []byte("bar"), 0600); err != nil {
+		t.Fatalf("unable to write token file, error %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("unable to touch token file, error %v", err)
+	}
+
+	cfg, err = a.Authorization()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := "bar", cfg.RegistryToken; expected != got {
+		t.Errorf("token does not match, expected %s got %s", expected, got)
+	}
+}
@@ -0,0 +1,200 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"path"
+	"strings"
+)
+
+// dockerHubAliases are docker hub registry names used on docker config files
+var dockerHubAliases = map[string]bool{
+	name.DefaultRegistry:   true,
+	"docker.io":            true,
+	"registry-1.docker.io": true,
+}
+
+type dockerConfigEntry struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	RegistryToken string `json:"registrytoken,omitempty"`
+}
+
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type pullSecretCredential struct {
+	host string
+	path string
+	auth authn.AuthConfig
+}
+
+type pullSecretKeychain struct {
+	credentials []pullSecretCredential
+}
+
+// NewPullSecretKeychain builds a keychain from dockerconfigjson and dockercfg pull secrets, credentials are
+// matched as kubelet does: registry host (wildcards allowed) and the longest matching repository path prefix
+func NewPullSecretKeychain(secrets []corev1.Secret) (authn.Keychain, error) {
+	kc := &pullSecretKeychain{}
+	for _, s := range secrets {
+		var entries map[string]dockerConfigEntry
+		switch s.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			cfg := dockerConfigJSON{}
+			if err := json.Unmarshal(s.Data[corev1.DockerConfigJsonKey], &cfg); err != nil {
+				return nil, fmt.Errorf("unable to parse secret %s/%s, error %w", s.Namespace, s.Name, err)
+			}
+			entries = cfg.Auths
+		case corev1.SecretTypeDockercfg:
+			if err := json.Unmarshal(s.Data[corev1.DockerConfigKey], &entries); err != nil {
+				return nil, fmt.Errorf("unable to parse secret %s/%s, error %w", s.Namespace, s.Name, err)
+			}
+		default:
+			continue
+		}
+
+		for key, e := range entries {
+			c, err := newPullSecretCredential(key, e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret %s/%s entry %s, error %w", s.Namespace, s.Name, key, err)
+			}
+			kc.credentials = append(kc.credentials, c)
+		}
+	}
+
+	return kc, nil
+}
+
+func newPullSecretCredential(key string, e dockerConfigEntry) (pullSecretCredential, error) {
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	key = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(key, "/"), "/v1"), "/v2")
+	parts := strings.SplitN(key, "/", 2)
+	c := pullSecretCredential{host: strings.ToLower(parts[0])}
+	if len(parts) == 2 {
+		c.path = parts[1]
+	}
+
+	if dockerHubAliases[c.host] {
+		c.host = name.DefaultRegistry
+	}
+
+	c.auth = authn.AuthConfig{Username: e.Username, Password: e.Password, IdentityToken: e.IdentityToken, RegistryToken: e.RegistryToken}
+	if e.Auth != "" {
+		raw, err := base64.StdEncoding.DecodeString(e.Auth)
+		if err != nil {
+			return c, err
+		}
+
+		userPass := strings.SplitN(string(raw), ":", 2)
+		if len(userPass) != 2 {
+			return c, fmt.Errorf("invalid auth field")
+		}
+		c.auth.Username, c.auth.Password = userPass[0], userPass[1]
+	}
+
+	return c, nil
+}
+
+// Resolve returns the most specific matching credential, anonymous if none matches
+func (k *pullSecretKeychain) Resolve(res authn.Resource) (authn.Authenticator, error) {
+	host := strings.ToLower(res.RegistryStr())
+	repository := strings.TrimPrefix(strings.TrimPrefix(res.String(), res.RegistryStr()), "/")
+
+	var match *pullSecretCredential
+	for i, c := range k.credentials {
+		if ok, _ := path.Match(c.host, host); !ok {
+			continue
+		}
+
+		if c.path != "" && repository != c.path && !strings.HasPrefix(repository, c.path+"/") {
+			continue
+		}
+
+		if match == nil || len(c.path) > len(match.path) {
+			match = &k.credentials[i]
+		}
+	}
+
+	if match == nil {
+		return authn.Anonymous, nil
+	}
+
+	return authn.FromConfig(match.auth), nil
+}
+
+type sourceKeychainKey struct{}
+
+// WithSourceKeychain returns a context whose source image requests are authenticated from keychain, requests are
+// anonymous when keychain has no matching credential
+func WithSourceKeychain(ctx context.Context, kc authn.Keychain) context.Context {
+	return context.WithValue(ctx, sourceKeychainKey{}, kc)
+}
+
+type staticKeychain struct {
+	auth authn.Authenticator
+}
+
+func (s staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return s.auth, nil
+}
+
+// keychain resolves image credentials, backup registry images always use backup registry credentials. Source
+// images use context source keychain, backup registry credentials are only sent to backup registry host and
+// any other source registry is requested anonymously
+func (d *dockerRegistry) keychain(ctx context.Context, image string) authn.Keychain {
+	if !d.IsNonImageBackup(image) {
+		return staticKeychain{auth: d.credentials}
+	}
+
+	return sourceKeychain(ctx, NewRegistryKeychain(d.backupRegistry, d.credentials))
+}
+
+// sourceKeychain combines context source keychain with backup registry keychain, source keychain credentials take
+// precedence
+func sourceKeychain(ctx context.Context, backup authn.Keychain) authn.Keychain {
+	kc, ok := ctx.Value(sourceKeychainKey{}).(authn.Keychain)
+	if !ok {
+		return backup
+	}
+
+	return authn.NewMultiKeychain(kc, backup)
+}
+
+// NewRegistryKeychain returns a keychain that only sends backup registry credentials to backup registry host, any
+// other registry is requested anonymously
+func NewRegistryKeychain(backupRegistry string, auth authn.Authenticator) authn.Keychain {
+	return registryKeychain{registry: registryHost(backupRegistry), auth: auth}
+}
+
+// registryHost returns backup registry host, empty if backup registry can not be parsed
+func registryHost(backupRegistry string) string {
+	ref, err := name.ParseReference(backupRegistry + "registry")
+	if err != nil {
+		return ""
+	}
+
+	return ref.Context().RegistryStr()
+}
+
+type registryKeychain struct {
+	registry string
+	auth     authn.Authenticator
+}
+
+// Resolve returns registry credentials on registry resources only
+func (r registryKeychain) Resolve(res authn.Resource) (authn.Authenticator, error) {
+	if res.RegistryStr() != r.registry {
+		return authn.Anonymous, nil
+	}
+
+	return r.auth, nil
+}
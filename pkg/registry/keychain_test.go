@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestPullSecretKeychainResolvesMostSpecificCredential(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("ghcr:ghcrToken"))
+	secrets := []corev1.Secret{
+		{
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{
+				"ghcr.io":{"auth":"` + auth + `"},
+				"ghcr.io/partner":{"username":"partner","password":"partnerToken"},
+				"https://index.docker.io/v1/":{"username":"hub","password":"hubToken"}
+			}}`)},
+		},
+		{
+			Type: corev1.SecretTypeDockercfg,
+			Data: map[string][]byte{corev1.DockerConfigKey: []byte(`{"*.harbor.example.com":{"username":"harbor","password":"harborToken"}}`)},
+		},
+		{
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{"foo": []byte("bar")},
+		},
+	}
+
+	kc, err := NewPullSecretKeychain(secrets)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var testSamples = []struct {
+		image    string
+		username string
+	}{
+		{image: "ghcr.io/org/app:v1", username: "ghcr"},
+		{image: "ghcr.io/partner/app:v1", username: "partner"},
+		{image: "ghcr.io/partnership/app:v1", username: "ghcr"},
+		{image: "nginx:1.14.2", username: "hub"},
+		{image: "eu.harbor.example.com/project/app:v1", username: "harbor"},
+		{image: "quay.io/org/app:v1", username: ""},
+	}
+
+	for _, sample := range testSamples {
+		ref, err := name.ParseReference(sample.image)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		a, err := kc.Resolve(ref.Context())
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		cfg, err := a.Authorization()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if expected, got := sample.username, cfg.Username; expected != got {
+			t.Errorf("username does not match on image %s, expected %q got %q", sample.image, expected, got)
+		}
+	}
+}
+
+func TestSourceKeychainIsNotUsedOnBackupRegistryImages(t *testing.T) {
+	kc := staticKeychain{auth: authn.FromConfig(authn.AuthConfig{Username: "source"})}
+	d := NewDockerRegistry("docker.io/backupregistry/", "backup", "token").(*dockerRegistry)
+	ctx := WithSourceKeychain(context.Background(), kc)
+
+	var testSamples = []struct {
+		image    string
+		username string
+	}{
+		{image: "ghcr.io/org/app:v1", username: "source"},
+		{image: "docker.io/backupregistry/ghcr.io__org__app:v1", username: "backup"},
+	}
+
+	for _, sample := range testSamples {
+		ref, _ := name.ParseReference(sample.image)
+		a, err := d.keychain(ctx, sample.image).Resolve(ref.Context())
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		cfg, _ := a.Authorization()
+		if expected, got := sample.username, cfg.Username; expected != got {
+			t.Errorf("username does not match on image %s, expected %q got %q", sample.image, expected, got)
+		}
+	}
+}
+
+func TestBackupCredentialsAreScopedToBackupRegistryHost(t *testing.T) {
+	d := NewDockerRegistry("registry.example.com/backup/", "backup", "token").(*dockerRegistry)
+	kc, err := NewPullSecretKeychain(nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var testSamples = []struct {
+		ctx      context.Context
+		image    string
+		username string
+	}{
+		{ctx: context.Background(), image: "ghcr.io/org/app:v1", username: ""},
+		{ctx: WithSourceKeychain(context.Background(), kc), image: "ghcr.io/org/app:v1", username: ""},
+		{ctx: context.Background(), image: "registry.example.com/team/app:v1", username: "backup"},
+		{ctx: WithSourceKeychain(context.Background(), kc), image: "registry.example.com/team/app:v1", username: "backup"},
+		{ctx: context.Background(), image: "registry.example.com/backup/app:v1", username: "backup"},
+	}
+
+	for _, sample := range testSamples {
+		ref, _ := name.ParseReference(sample.image)
+		a, err := d.keychain(sample.ctx, sample.image).Resolve(ref.Context())
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		cfg, _ := a.Authorization()
+		if expected, got := sample.username, cfg.Username; expected != got {
+			t.Errorf("username does not match on image %s, expected %q got %q", sample.image, expected, got)
+		}
+	}
+}
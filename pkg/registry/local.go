@@ -0,0 +1,440 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LocalFormatOCILayout stores backups on a single OCI image layout, images are identified by its ref name annotation
+	LocalFormatOCILayout = "OCILayout"
+	// LocalFormatTarball stores each backup as a docker save tarball, multi platform images keep its default or first
+	// configured platform
+	LocalFormatTarball = "Tarball"
+)
+
+// DefaultLocalRepository is the local backup images name prefix, local backup images are not pullable
+const DefaultLocalRepository = "image-backup.local/"
+
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// Pullable reports if workloads can pull registry backup images, registries not telling it are pullable
+func Pullable(reg DockerRegistry) bool {
+	p, ok := reg.(interface{ Pullable() bool })
+	return !ok || p.Pullable()
+}
+
+type localRegistry struct {
+	mutex      sync.Mutex
+	repository string
+	root       string
+	format     string
+	naming     NamingStrategy
+	platforms  []v1.Platform
+}
+
+// NewLocalRegistry instantiates a filesystem backup store on root path, backup images are named under repository
+// prefix. Only naming strategy and platforms options apply, source images are pulled with source keychain or anonymously
+func NewLocalRegistry(repository, root, format string, opts ...Option) (DockerRegistry, error) {
+	if format == "" {
+		format = LocalFormatOCILayout
+	}
+
+	if format != LocalFormatOCILayout && format != LocalFormatTarball {
+		return nil, fmt.Errorf("unknown local format %s", format)
+	}
+
+	d := &dockerRegistry{naming: legacyNaming{}}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create local backup path %s, error %w", root, err)
+	}
+
+	if format == LocalFormatOCILayout {
+		if _, err := layout.FromPath(root); err != nil {
+			if _, err := layout.Write(root, empty.Index); err != nil {
+				return nil, fmt.Errorf("unable to create OCI layout on %s, error %w", root, err)
+			}
+		}
+	}
+
+	return &localRegistry{
+		repository: repository,
+		root:       root,
+		format:     format,
+		naming:     d.naming,
+		platforms:  d.platforms,
+	}, nil
+}
+
+// Pullable reports local backup images can not be pulled by workloads
+func (l *localRegistry) Pullable() bool {
+	return false
+}
+
+// IsNonImageBackup checks if provided image is out of local repository
+func (l *localRegistry) IsNonImageBackup(image string) bool {
+	return !strings.HasPrefix(image, l.repository)
+}
+
+// prefix returns backup images name prefix
+func (l *localRegistry) prefix() string {
+	return l.repository
+}
+
+// Exists checks backup image existence on local store
+func (l *localRegistry) Exists(ctx context.Context, image string) (bool, error) {
+	startTs := time.Now()
+	defer func() {
+		existsCalls.Inc()
+		existsDuration.Add(time.Since(startTs).Seconds())
+	}()
+
+	if l.format == LocalFormatTarball {
+		path, err := l.tarballPath(image)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		if err != nil {
+			existsErroredCalls.Inc()
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	_, ok, err := l.descriptor(image)
+	if err != nil {
+		existsErroredCalls.Inc()
+	}
+
+	return ok, err
+}
+
+// Backup pulls source image to local store
+func (l *localRegistry) Backup(ctx context.Context, imageSource, imageDestination string, opts ...BackupOption) error {
+	backupCalls.Inc()
+	startTs := time.Now()
+	defer func() {
+		backupDuration.Add(time.Since(startTs).Seconds())
+	}()
+
+	o := &backupOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var err error
+	if l.format == LocalFormatTarball {
+		err = l.writeTarball(ctx, imageSource, imageDestination, o.progress)
+	} else {
+		err = l.writeLayout(ctx, imageSource, imageDestination, o.progress)
+	}
+
+	if err != nil {
+		backupErroredCalls.Inc()
+		return fmt.Errorf("unexpected error copying image src %s dst %s, error %w", imageSource, imageDestination, err)
+	}
+
+	return nil
+}
+
+// BackupImageName formats local backup image name
+func (l *localRegistry) BackupImageName(image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	repository := l.naming.Repository(l.repository, ref)
+	if _, ok := ref.(name.Digest); ok {
+		return fmt.Sprintf("%s@%s", repository, ref.Identifier()), nil
+	}
+
+	return fmt.Sprintf("%s:%s", repository, ref.Identifier()), nil
+}
+
+// Digest returns stored backup image manifest digest
+func (l *localRegistry) Digest(ctx context.Context, image string) (string, error) {
+	if l.format == LocalFormatTarball {
+		path, err := l.tarballPath(image)
+		if err != nil {
+			return "", err
+		}
+
+		img, err := tarball.ImageFromPath(path, nil)
+		if err != nil {
+			return "", fmt.Errorf("unable to read image %s tarball, error %w", image, err)
+		}
+
+		h, err := img.Digest()
+		if err != nil {
+			return "", err
+		}
+
+		return h.String(), nil
+	}
+
+	desc, ok, err := l.descriptor(image)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", fmt.Errorf("image %s not found on local store", image)
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// Delete removes backup image from local store, OCI layout blobs are kept as they may be shared
+func (l *localRegistry) Delete(ctx context.Context, image string) error {
+	if l.format == LocalFormatTarball {
+		path, err := l.tarballPath(image)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to delete image %s tarball, error %w", image, err)
+		}
+
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	p, err := layout.FromPath(l.root)
+	if err != nil {
+		return err
+	}
+
+	return p.RemoveDescriptors(match.Name(image))
+}
+
+// DockerConfigJSON returns an empty dockerconfigjson, local store has no credentials
+func (l *localRegistry) DockerConfigJSON() ([]byte, error) {
+	return json.Marshal(dockerConfigJSON{Auths: map[string]dockerConfigEntry{}})
+}
+
+func (l *localRegistry) descriptor(image string) (v1.Descriptor, bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	idx, err := layout.ImageIndexFromPath(l.root)
+	if err != nil {
+		return v1.Descriptor{}, false, fmt.Errorf("unable to read OCI layout %s, error %w", l.root, err)
+	}
+
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return v1.Descriptor{}, false, err
+	}
+
+	for _, desc := range m.Manifests {
+		if match.Name(image)(desc) {
+			return desc, true, nil
+		}
+	}
+
+	return v1.Descriptor{}, false, nil
+}
+
+// writeLayout writes source image or index to OCI layout, layout blobs are written before replacing image descriptor.
+// Layout writes are serialized as layout blobs are not written atomically
+func (l *localRegistry) writeLayout(ctx context.Context, imageSource, imageDestination string, fn ProgressFunc) error {
+	desc, err := l.get(ctx, imageSource)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	p, err := layout.FromPath(l.root)
+	if err != nil {
+		return err
+	}
+
+	var layers []v1.Layer
+	var write func() error
+	annotations := layout.WithAnnotations(map[string]string{ociRefNameAnnotation: imageDestination})
+	switch desc.MediaType {
+	case types.OCIImageIndex, types.DockerManifestList:
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+
+		if idx, err = filterIndex(idx, l.platforms); err != nil {
+			return err
+		}
+
+		if layers, err = indexLayers(idx); err != nil {
+			return err
+		}
+		write = func() error { return p.ReplaceIndex(idx, match.Name(imageDestination), annotations) }
+	default:
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+
+		if layers, err = img.Layers(); err != nil {
+			return err
+		}
+		write = func() error { return p.ReplaceImage(img, match.Name(imageDestination), annotations) }
+	}
+
+	t, err := newProgressTracker(layers, fn)
+	if err != nil {
+		return err
+	}
+
+	t.report()
+	for h, layer := range t.layers {
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+
+		if err := p.WriteBlob(h, rc); err != nil {
+			return fmt.Errorf("unable to write layer %s, error %w", h, err)
+		}
+		t.layerDone(h)
+	}
+
+	return write()
+}
+
+// writeTarball writes source image to a temporary tarball renamed once completed
+func (l *localRegistry) writeTarball(ctx context.Context, imageSource, imageDestination string, fn ProgressFunc) error {
+	srcRef, err := name.ParseReference(imageSource)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	dstRef, err := name.ParseReference(imageDestination)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(l.keychain(ctx))}
+	if len(l.platforms) > 0 {
+		// tarballs hold a single image, first platform is kept
+		opts = append(opts, remote.WithPlatform(l.platforms[0]))
+	}
+
+	img, err := remote.Image(srcRef, opts...)
+	if err != nil {
+		return fmt.Errorf("unable to get image %q, error %w", srcRef, err)
+	}
+
+	path, err := l.tarballPath(imageDestination)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	t, err := newProgressTracker(layers, fn)
+	if err != nil {
+		return err
+	}
+
+	updates := make(chan v1.Update, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for u := range updates {
+			if u.Error == nil && u.Total > 0 {
+				// tarball size includes headers and config, progress is scaled to layers size
+				t.scaled(u.Complete, u.Total)
+			}
+		}
+	}()
+
+	tmp := path + ".tmp"
+	err = tarball.WriteToFile(tmp, dstRef, img, tarball.WithProgress(updates))
+	close(updates)
+	<-done
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	t.completed()
+	return os.Rename(tmp, path)
+}
+
+func (l *localRegistry) get(ctx context.Context, image string) (*remote.Descriptor, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	desc, err := remote.Get(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(l.keychain(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get image %q, error %w", ref, err)
+	}
+
+	return desc, nil
+}
+
+// keychain resolves source image credentials from context source keychain, anonymous otherwise
+func (l *localRegistry) keychain(ctx context.Context) authn.Keychain {
+	if kc, ok := ctx.Value(sourceKeychainKey{}).(authn.Keychain); ok {
+		return kc
+	}
+
+	return staticKeychain{auth: authn.Anonymous}
+}
+
+// tarballPath locates backup image tarball under root path as repository/identifier.tar
+func (l *localRegistry) tarballPath(image string) (string, error) {
+	if l.IsNonImageBackup(image) {
+		return "", fmt.Errorf("image %s is not a local backup image", image)
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	repository := strings.TrimPrefix(ref.Context().Name(), strings.TrimSuffix(l.repository, "/"))
+	file := strings.ReplaceAll(ref.Identifier(), ":", "-") + ".tar"
+	return filepath.Join(l.root, filepath.FromSlash(strings.Trim(repository, "/")), file), nil
+}
@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestLocalRegistryBackupLifecycle(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	if err := crane.Push(img, src); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	for _, format := range []string{LocalFormatOCILayout, LocalFormatTarball} {
+		root := t.TempDir()
+		r, err := NewLocalRegistry(DefaultLocalRepository, root, format)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if Pullable(r) {
+			t.Errorf("%s local backups must not be pullable", format)
+		}
+
+		dst, err := r.BackupImageName(src)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if r.IsNonImageBackup(dst) {
+			t.Errorf("%s expected backup image %s", format, dst)
+		}
+
+		ctx := context.Background()
+		if ok, err := r.Exists(ctx, dst); err != nil || ok {
+			t.Fatalf("%s unexpected existence %t error %v", format, ok, err)
+		}
+
+		var last Progress
+		if err := r.Backup(ctx, src, dst, WithProgress(func(p Progress) { last = p })); err != nil {
+			t.Fatalf("%s unexpected error %v", format, err)
+		}
+
+		if last.TotalLayers != 3 || last.CompleteLayers != last.TotalLayers || last.CompleteBytes != last.TotalBytes {
+			t.Errorf("%s backup not completed, progress %+v", format, last)
+		}
+
+		if ok, err := r.Exists(ctx, dst); err != nil || !ok {
+			t.Fatalf("%s expected existence, error %v", format, err)
+		}
+
+		digest, err := r.Digest(ctx, dst)
+		if err != nil || digest == "" {
+			t.Fatalf("%s unexpected digest %s error %v", format, digest, err)
+		}
+
+		if err := r.Delete(ctx, dst); err != nil {
+			t.Fatalf("%s unexpected error %v", format, err)
+		}
+
+		if ok, err := r.Exists(ctx, dst); err != nil || ok {
+			t.Fatalf("%s unexpected existence after delete %t error %v", format, ok, err)
+		}
+	}
+}
+
+func TestLocalRegistryStoresRestorableImages(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+	idx, err := random.Index(512, 2, 2)
+	if err != nil {
+		t.Fatalf("unable to create random index, error %v", err)
+	}
+
+	ref, _ := name.ParseReference(src)
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatalf("unable to push index, error %v", err)
+	}
+
+	expected, _ := idx.Digest()
+	root := t.TempDir()
+	r, err := NewLocalRegistry(DefaultLocalRepository, root, LocalFormatOCILayout)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	dst, _ := r.BackupImageName(src)
+	if err := r.Backup(context.Background(), src, dst); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	got, err := r.Digest(context.Background(), dst)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected.String() != got {
+		t.Errorf("index digest does not match, expected %s got %s", expected, got)
+	}
+
+	stored, err := layout.ImageIndexFromPath(root)
+	if err != nil {
+		t.Fatalf("unable to read layout, error %v", err)
+	}
+
+	if _, err := stored.ImageIndex(expected); err != nil {
+		t.Errorf("stored index not readable, error %v", err)
+	}
+
+	tr, err := NewLocalRegistry(DefaultLocalRepository, t.TempDir(), LocalFormatTarball)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := tr.Backup(context.Background(), src, dst); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	path, _ := tr.(*localRegistry).tarballPath(dst)
+	tag, _ := name.NewTag(dst)
+	if _, err := tarball.ImageFromPath(path, &tag); err != nil {
+		t.Errorf("tarball not loadable by tag, error %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/name"
+	"path"
+	"strings"
+)
+
+const (
+	// LegacyNamingStrategy keeps repository path replacing slashes by underscores, source registry is lost
+	LegacyNamingStrategy = "legacy"
+	// FlatNamingStrategy encodes source registry and repository in a single repository name
+	FlatNamingStrategy = "flat"
+	// HierarchicalNamingStrategy nests source registry and repository under backup registry
+	HierarchicalNamingStrategy = "hierarchical"
+	// HashedNamingStrategy uses repository base name plus source registry and repository hash
+	HashedNamingStrategy = "hashed"
+)
+
+const (
+	flatPathSeparator = "__"
+	flatEscapedUnder  = "_u"
+	flatEscapedColon  = "_c"
+	hashedSuffixSize  = 12
+)
+
+// NamingStrategy builds backup repository names from source image references
+type NamingStrategy interface {
+	Repository(backupRegistry string, ref name.Reference) string
+}
+
+// ReversibleNamingStrategy recovers source repositories from backup repository names
+type ReversibleNamingStrategy interface {
+	NamingStrategy
+	SourceRepository(backupRegistry, repository string) (string, error)
+}
+
+// NamingStrategyFromName returns naming strategy by name, empty name defaults to legacy so that existing backups
+// keep its names on upgrade
+func NamingStrategyFromName(strategy string) (NamingStrategy, error) {
+	switch strategy {
+	case FlatNamingStrategy:
+		return flatNaming{}, nil
+	case "", LegacyNamingStrategy:
+		return legacyNaming{}, nil
+	case HierarchicalNamingStrategy:
+		return hierarchicalNaming{}, nil
+	case HashedNamingStrategy:
+		return hashedNaming{}, nil
+	default:
+		return nil, fmt.Errorf("unknown naming strategy %s", strategy)
+	}
+}
+
+type legacyNaming struct{}
+
+// Repository joins repository path by underscores, docker.io/library/nginx becomes <backup>library_nginx
+func (legacyNaming) Repository(backupRegistry string, ref name.Reference) string {
+	return backupRegistry + strings.ReplaceAll(ref.Context().RepositoryStr(), "/", "_")
+}
+
+type flatNaming struct{}
+
+// Repository encodes registry and repository in a single path component, docker.io/library/nginx
+// becomes <backup>index.docker.io__library__nginx. Underscores are escaped as "_u" and
+// registry port colons as "_c" so that the encoding is reversible and collision free
+func (flatNaming) Repository(backupRegistry string, ref name.Reference) string {
+	reg := strings.ReplaceAll(strings.ToLower(ref.Context().RegistryStr()), ":", flatEscapedColon)
+	parts := strings.Split(ref.Context().RepositoryStr(), "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(p, "_", flatEscapedUnder)
+	}
+
+	return backupRegistry + reg + flatPathSeparator + strings.Join(parts, flatPathSeparator)
+}
+
+// SourceRepository decodes flat backup repository into its source repository
+func (flatNaming) SourceRepository(backupRegistry, repository string) (string, error) {
+	if !strings.HasPrefix(repository, backupRegistry) {
+		return "", fmt.Errorf("repository %s does not belong to backup registry %s", repository, backupRegistry)
+	}
+
+	enc := strings.TrimPrefix(repository, backupRegistry)
+	var b strings.Builder
+	for i := 0; i < len(enc); i++ {
+		if enc[i] != '_' {
+			b.WriteByte(enc[i])
+			continue
+		}
+
+		if i+1 == len(enc) {
+			return "", fmt.Errorf("invalid flat repository %s", repository)
+		}
+
+		i++
+		switch enc[i] {
+		case '_':
+			b.WriteByte('/')
+		case 'u':
+			b.WriteByte('_')
+		case 'c':
+			b.WriteByte(':')
+		default:
+			return "", fmt.Errorf("invalid flat repository %s", repository)
+		}
+	}
+
+	return b.String(), nil
+}
+
+type hierarchicalNaming struct{}
+
+// Repository nests source registry and repository, docker.io/library/nginx becomes
+// <backup>/index.docker.io/library/nginx. Registry port colons are replaced by underscores
+func (hierarchicalNaming) Repository(backupRegistry string, ref name.Reference) string {
+	reg := strings.ReplaceAll(strings.ToLower(ref.Context().RegistryStr()), ":", "_")
+	return strings.TrimSuffix(backupRegistry, "/") + "/" + reg + "/" + ref.Context().RepositoryStr()
+}
+
+// SourceRepository decodes hierarchical backup repository into its source repository
+func (hierarchicalNaming) SourceRepository(backupRegistry, repository string) (string, error) {
+	prefix := strings.TrimSuffix(backupRegistry, "/") + "/"
+	if !strings.HasPrefix(repository, prefix) {
+		return "", fmt.Errorf("repository %s does not belong to backup registry %s", repository, backupRegistry)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(repository, prefix), "/", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid hierarchical repository %s", repository)
+	}
+
+	return strings.ReplaceAll(parts[0], "_", ":") + "/" + parts[1], nil
+}
+
+type hashedNaming struct{}
+
+// Repository keeps repository base name suffixed by registry and repository hash, docker.io/library/nginx
+// becomes <backup>nginx-<hash>. Hashed names are not reversible
+func (hashedNaming) Repository(backupRegistry string, ref name.Reference) string {
+	h := sha256.Sum256([]byte(ref.Context().Name()))
+	return backupRegistry + path.Base(ref.Context().RepositoryStr()) + "-" + hex.EncodeToString(h[:])[:hashedSuffixSize]
+}
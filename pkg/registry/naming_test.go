@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	"testing"
+)
+
+func TestBackupImageNameGenerationByNamingStrategy(t *testing.T) {
+	var testSamples = []struct {
+		strategy string
+		image    string
+		expected string
+	}{
+		{
+			strategy: FlatNamingStrategy,
+			image:    "nginx:1.21",
+			expected: "docker.io/backupregistry/index.docker.io__library__nginx:1.21",
+		},
+		{
+			strategy: FlatNamingStrategy,
+			image:    "quay.io/library/nginx:1.21",
+			expected: "docker.io/backupregistry/quay.io__library__nginx:1.21",
+		},
+		{
+			strategy: FlatNamingStrategy,
+			image:    "localhost:5000/a_b/c:1.0.0",
+			expected: "docker.io/backupregistry/localhost_c5000__a_ub__c:1.0.0",
+		},
+		{
+			strategy: HierarchicalNamingStrategy,
+			image:    "quay.io/library/nginx:1.21",
+			expected: "docker.io/backupregistry/quay.io/library/nginx:1.21",
+		},
+		{
+			strategy: HierarchicalNamingStrategy,
+			image:    "nginx@sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c",
+			expected: "docker.io/backupregistry/index.docker.io/library/nginx@sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c",
+		},
+		{
+			strategy: HashedNamingStrategy,
+			image:    "quay.io/library/nginx:1.21",
+			expected: "docker.io/backupregistry/nginx-625ff20570ac:1.21",
+		},
+	}
+
+	for _, sample := range testSamples {
+		n, err := NamingStrategyFromName(sample.strategy)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		r := NewDockerRegistry("docker.io/backupregistry/", "bar", "zoom", WithNamingStrategy(n))
+		res, err := r.BackupImageName(sample.image)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if expected, got := sample.expected, res; expected != got {
+			t.Errorf("values do not match on strategy %s, expected %s got %s", sample.strategy, expected, got)
+		}
+
+		if _, err := name.ParseReference(res); err != nil {
+			t.Errorf("invalid backup image name %s, error %v", res, err)
+		}
+	}
+}
+
+func TestFlatNamingStrategyAvoidsCollisions(t *testing.T) {
+	r := NewDockerRegistry("docker.io/backupregistry/", "bar", "zoom", WithNamingStrategy(flatNaming{}))
+	images := []string{
+		"docker.io/library/nginx:1.21",
+		"quay.io/library/nginx:1.21",
+		"docker.io/a/b_c:1.0",
+		"docker.io/a_b/c:1.0",
+	}
+
+	seen := map[string]string{}
+	for _, img := range images {
+		res, err := r.BackupImageName(img)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if prev, ok := seen[res]; ok {
+			t.Fatalf("backup image name collision %s from %s and %s", res, prev, img)
+		}
+		seen[res] = img
+	}
+}
+
+func TestDefaultNamingStrategyKeepsPreviousBackupNames(t *testing.T) {
+	// backup images pushed before naming strategies were introduced, rewritten workloads already point to them
+	previous := map[string]string{
+		"nginx:1.21":                 "docker.io/backupregistry/library_nginx:1.21",
+		"quay.io/org/team/app:1.0.0": "docker.io/backupregistry/org_team_app:1.0.0",
+	}
+
+	n, err := NamingStrategyFromName("")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	registries := []DockerRegistry{
+		NewDockerRegistry("docker.io/backupregistry/", "bar", "zoom"),
+		NewDockerRegistry("docker.io/backupregistry/", "bar", "zoom", WithNamingStrategy(n)),
+	}
+
+	for i, r := range registries {
+		for image, expected := range previous {
+			got, err := r.BackupImageName(image)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if expected != got {
+				t.Errorf("registry %d backup image name does not match on %s, expected %s got %s", i, image, expected, got)
+			}
+		}
+	}
+}
+
+func TestReversibleNamingStrategiesRecoverSourceRepository(t *testing.T) {
+	backupRegistry := "docker.io/backupregistry/"
+	images := []string{
+		"index.docker.io/library/nginx",
+		"quay.io/a_b/c",
+		"quay.io/a__b/c_",
+		"localhost:5000/foo/bar/zoom",
+	}
+
+	for _, strategy := range []string{FlatNamingStrategy, HierarchicalNamingStrategy} {
+		n, err := NamingStrategyFromName(strategy)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		rev, ok := n.(ReversibleNamingStrategy)
+		if !ok {
+			t.Fatalf("strategy %s expected to be reversible", strategy)
+		}
+
+		for _, img := range images {
+			ref, err := name.ParseReference(img, name.WeakValidation)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			src, err := rev.SourceRepository(backupRegistry, rev.Repository(backupRegistry, ref))
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if expected, got := img, src; expected != got {
+				t.Errorf("source repository does not match on strategy %s, expected %s got %s", strategy, expected, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"fmt"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// WithPlatforms filters copied indexes manifests by platform, single platform images are copied as they are
+func WithPlatforms(platforms ...v1.Platform) Option {
+	return func(d *dockerRegistry) {
+		d.platforms = platforms
+	}
+}
+
+// ParsePlatforms parses os/arch[/variant] platforms
+func ParsePlatforms(values []string) ([]v1.Platform, error) {
+	res := make([]v1.Platform, 0, len(values))
+	for _, v := range values {
+		p, err := v1.ParsePlatform(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform %s, error %w", v, err)
+		}
+
+		if p.OS == "" || p.Architecture == "" {
+			return nil, fmt.Errorf("invalid platform %s, os and architecture are required", v)
+		}
+		res = append(res, *p)
+	}
+
+	return res, nil
+}
+
+const (
+	// referenceTypeAnnotation flags index entries attesting another index manifest, as buildkit provenance and SBOMs
+	referenceTypeAnnotation = "vnd.docker.reference.type"
+	// referenceDigestAnnotation is the attested manifest digest
+	referenceDigestAnnotation = "vnd.docker.reference.digest"
+)
+
+// filterIndex trims index manifests not matching any platform, manifests without platform are kept. Attestation
+// manifests are kept along with the manifest they attest
+func filterIndex(idx v1.ImageIndex, platforms []v1.Platform) (v1.ImageIndex, error) {
+	if len(platforms) == 0 {
+		return idx, nil
+	}
+
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	kept := map[string]bool{}
+	for _, desc := range m.Manifests {
+		if _, ok := desc.Annotations[referenceTypeAnnotation]; ok {
+			continue
+		}
+
+		if desc.Platform == nil || matchesPlatform(*desc.Platform, platforms) {
+			kept[desc.Digest.String()] = true
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no index manifest matches platforms %v", platforms)
+	}
+
+	return mutate.RemoveManifests(idx, func(desc v1.Descriptor) bool {
+		if _, ok := desc.Annotations[referenceTypeAnnotation]; ok {
+			return !kept[desc.Annotations[referenceDigestAnnotation]]
+		}
+
+		return !kept[desc.Digest.String()]
+	}), nil
+}
+
+// matchesPlatform checks platform satisfies any spec, empty spec variant and os version match any value
+func matchesPlatform(p v1.Platform, specs []v1.Platform) bool {
+	for _, s := range specs {
+		if p.OS != s.OS || p.Architecture != s.Architecture {
+			continue
+		}
+
+		if s.Variant != "" && p.Variant != s.Variant {
+			continue
+		}
+
+		if s.OSVersion != "" && p.OSVersion != s.OSVersion {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
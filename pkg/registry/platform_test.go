@@ -0,0 +1,207 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDockerRegistryBackupTrimsIndexPlatforms(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+	dst := fmt.Sprintf("%s/backupregistry/nginx:1.14.2", u.Host)
+	idx := newPlatformIndex(t, "linux/amd64", "linux/arm64/v8", "linux/s390x", "windows/amd64")
+	ref, _ := name.ParseReference(src)
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatalf("unable to push index, error %v", err)
+	}
+
+	platforms, err := ParsePlatforms([]string{"linux/amd64", "linux/arm64"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	r := NewDockerRegistry(u.Host+"/backupregistry/", "foo", "bar", WithPlatforms(platforms...))
+	if err := r.Backup(context.Background(), src, dst); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	dstRef, _ := name.ParseReference(dst)
+	backup, err := remote.Index(dstRef)
+	if err != nil {
+		t.Fatalf("unable to get backup index, error %v", err)
+	}
+
+	m, err := backup.IndexManifest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var got []string
+	for _, desc := range m.Manifests {
+		got = append(got, desc.Platform.String())
+	}
+
+	if expected := "[linux/amd64 linux/arm64/v8]"; expected != fmt.Sprint(got) {
+		t.Errorf("platforms do not match, expected %s got %v", expected, got)
+	}
+}
+
+func TestDockerRegistryBackupFailsWithoutMatchingPlatforms(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+	ref, _ := name.ParseReference(src)
+	if err := remote.WriteIndex(ref, newPlatformIndex(t, "linux/s390x")); err != nil {
+		t.Fatalf("unable to push index, error %v", err)
+	}
+
+	platforms, _ := ParsePlatforms([]string{"linux/amd64"})
+	r := NewDockerRegistry(u.Host+"/backupregistry/", "foo", "bar", WithPlatforms(platforms...))
+	if err := r.Backup(context.Background(), src, u.Host+"/backupregistry/nginx:1.14.2"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDockerRegistryExistsHandlesImagesAndIndexes(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatalf("unable to create image, error %v", err)
+	}
+
+	image := u.Host + "/backupregistry/single:1.0.0"
+	if err := crane.Push(img, image); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	index := u.Host + "/backupregistry/multi:1.0.0"
+	ref, _ := name.ParseReference(index)
+	if err := remote.WriteIndex(ref, newPlatformIndex(t, "linux/amd64")); err != nil {
+		t.Fatalf("unable to push index, error %v", err)
+	}
+
+	r := NewDockerRegistry(u.Host+"/backupregistry/", "foo", "bar")
+	var testSamples = []struct {
+		image    string
+		expected bool
+	}{
+		{image: image, expected: true},
+		{image: index, expected: true},
+		{image: u.Host + "/backupregistry/missing:1.0.0", expected: false},
+	}
+
+	for _, sample := range testSamples {
+		ok, err := r.Exists(context.Background(), sample.image)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		if expected, got := sample.expected, ok; expected != got {
+			t.Errorf("existence does not match on %s, expected %t got %t", sample.image, expected, got)
+		}
+	}
+}
+
+func TestParsePlatformsRequiresOSAndArchitecture(t *testing.T) {
+	if _, err := ParsePlatforms([]string{"linux"}); err == nil {
+		t.Error("expected error")
+	}
+
+	p, err := ParsePlatforms([]string{"linux/arm64/v8"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if !matchesPlatform(v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, p) {
+		t.Error("expected platform match")
+	}
+
+	if matchesPlatform(v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v7"}, p) {
+		t.Error("unexpected platform match")
+	}
+}
+
+func newPlatformIndex(t *testing.T, platforms ...string) v1.ImageIndex {
+	var idx v1.ImageIndex = empty.Index
+	for _, platform := range platforms {
+		img, err := random.Image(512, 1)
+		if err != nil {
+			t.Fatalf("unable to create image, error %v", err)
+		}
+
+		p, err := v1.ParsePlatform(platform)
+		if err != nil {
+			t.Fatalf("unable to parse platform, error %v", err)
+		}
+
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: p}})
+	}
+
+	return idx
+}
+
+func TestFilterIndexKeepsAttestationsOfKeptManifests(t *testing.T) {
+	idx := newPlatformIndex(t, "linux/amd64", "linux/arm64/v8")
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// buildkit attests each platform manifest with an unknown/unknown manifest
+	attestations := map[string]string{}
+	for _, desc := range m.Manifests {
+		att, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatalf("unable to create image, error %v", err)
+		}
+
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{Add: att, Descriptor: v1.Descriptor{
+			Platform:    &v1.Platform{OS: "unknown", Architecture: "unknown"},
+			Annotations: map[string]string{referenceTypeAnnotation: "attestation-manifest", referenceDigestAnnotation: desc.Digest.String()},
+		}})
+		attestations[desc.Digest.String()] = desc.Platform.String()
+	}
+
+	platforms, _ := ParsePlatforms([]string{"linux/amd64"})
+	filtered, err := filterIndex(idx, platforms)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	fm, err := filtered.IndexManifest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var got []string
+	for _, desc := range fm.Manifests {
+		if subject, ok := desc.Annotations[referenceDigestAnnotation]; ok {
+			got = append(got, "attestation "+attestations[subject])
+			continue
+		}
+		got = append(got, desc.Platform.String())
+	}
+
+	if expected := "[linux/amd64 attestation linux/amd64]"; expected != fmt.Sprint(got) {
+		t.Errorf("manifests do not match, expected %s got %v", expected, got)
+	}
+}
@@ -0,0 +1,300 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"sync"
+)
+
+// progressLayerJobs is the number of layers written concurrently on tracked backups
+const progressLayerJobs = 4
+
+// Progress describes backup copy progress
+type Progress struct {
+	CompleteBytes  int64
+	TotalBytes     int64
+	CompleteLayers int
+	TotalLayers    int
+}
+
+// ProgressFunc receives backup progress, it is called on every written chunk so receivers must throttle it
+type ProgressFunc func(Progress)
+
+// BackupOption configures backup execution
+type BackupOption func(*backupOptions)
+
+type backupOptions struct {
+	progress  ProgressFunc
+	artifacts ArtifactFunc
+}
+
+// WithProgress tracks backup progress, layers are written one by one so that completed layers are reported
+func WithProgress(fn ProgressFunc) BackupOption {
+	return func(o *backupOptions) {
+		o.progress = fn
+	}
+}
+
+// copy copies source image or index layers reporting its progress if required, manifests are written once all
+// layers are available on destination. Indexes are trimmed to configured platforms. Source and destination are
+// authenticated independently, legacy schema 1 images are copied without progress
+func (d *dockerRegistry) copy(ctx context.Context, imageSource, imageDestination string, fn ProgressFunc) error {
+	srcRef, err := name.ParseReference(imageSource)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	dstRef, err := name.ParseReference(imageDestination)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	srcOpts := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(d.keychain(ctx, imageSource))}
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithAuth(d.credentials)}
+	desc, err := remote.Get(srcRef, srcOpts...)
+	if err != nil {
+		return fmt.Errorf("unable to get image %q, error %w", srcRef, err)
+	}
+
+	var layers []v1.Layer
+	var write func() error
+	switch desc.MediaType {
+	case types.OCIImageIndex, types.DockerManifestList:
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+
+		if idx, err = filterIndex(idx, d.platforms); err != nil {
+			return err
+		}
+
+		if layers, err = indexLayers(idx); err != nil {
+			return err
+		}
+		write = func() error { return remote.WriteIndex(dstRef, idx, opts...) }
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+		kc := authn.NewMultiKeychain(registryKeychain{registry: dstRef.Context().RegistryStr(), auth: d.credentials}, d.keychain(ctx, imageSource))
+		return crane.Copy(imageSource, imageDestination, crane.WithContext(ctx), crane.WithAuthFromKeychain(kc))
+	default:
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+
+		if layers, err = img.Layers(); err != nil {
+			return err
+		}
+		write = func() error { return remote.Write(dstRef, img, opts...) }
+	}
+
+	t, err := newProgressTracker(layers, fn)
+	if err != nil {
+		return err
+	}
+
+	if err := t.writeLayers(dstRef.Context(), opts); err != nil {
+		return err
+	}
+
+	return write()
+}
+
+// indexLayers returns index images layers, nested indexes included
+func indexLayers(idx v1.ImageIndex) ([]v1.Layer, error) {
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []v1.Layer
+	for _, desc := range m.Manifests {
+		switch desc.MediaType {
+		case types.OCIImageIndex, types.DockerManifestList:
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			ls, err := indexLayers(child)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, ls...)
+		case types.OCIManifestSchema1, types.DockerManifestSchema2:
+			img, err := idx.Image(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+
+			ls, err := img.Layers()
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, ls...)
+		}
+	}
+
+	return layers, nil
+}
+
+type progressTracker struct {
+	mutex    sync.Mutex
+	layers   map[v1.Hash]v1.Layer
+	sizes    map[v1.Hash]int64
+	complete map[v1.Hash]int64
+	progress Progress
+	fn       ProgressFunc
+}
+
+// newProgressTracker tracks unique layers progress, nil progress func discards updates
+func newProgressTracker(layers []v1.Layer, fn ProgressFunc) (*progressTracker, error) {
+	if fn == nil {
+		fn = func(Progress) {}
+	}
+
+	t := &progressTracker{
+		layers:   map[v1.Hash]v1.Layer{},
+		sizes:    map[v1.Hash]int64{},
+		complete: map[v1.Hash]int64{},
+		fn:       fn,
+	}
+
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := t.layers[h]; ok {
+			continue
+		}
+
+		size, err := l.Size()
+		if err != nil {
+			return nil, err
+		}
+
+		t.layers[h] = l
+		t.sizes[h] = size
+		t.progress.TotalBytes += size
+		t.progress.TotalLayers++
+	}
+
+	return t, nil
+}
+
+// writeLayers writes unique layers concurrently, first error is returned
+func (t *progressTracker) writeLayers(repo name.Repository, opts []remote.Option) error {
+	t.report()
+
+	sem := make(chan struct{}, progressLayerJobs)
+	errs := make(chan error, len(t.layers))
+	wg := sync.WaitGroup{}
+	for h, l := range t.layers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(h v1.Hash, l v1.Layer) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := t.writeLayer(repo, h, l, opts); err != nil {
+				errs <- fmt.Errorf("unable to write layer %s, error %w", h, err)
+			}
+		}(h, l)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+func (t *progressTracker) writeLayer(repo name.Repository, h v1.Hash, l v1.Layer, opts []remote.Option) error {
+	updates := make(chan v1.Update, 16)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case u, ok := <-updates:
+				if !ok {
+					return
+				}
+
+				if u.Error == nil {
+					t.update(h, u.Complete)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	err := remote.WriteLayer(repo, l, append(opts, remote.WithProgress(updates))...)
+	close(stop)
+	<-done
+	if err != nil {
+		return err
+	}
+
+	t.layerDone(h)
+	return nil
+}
+
+func (t *progressTracker) update(h v1.Hash, complete int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if complete > t.sizes[h] {
+		complete = t.sizes[h]
+	}
+
+	t.progress.CompleteBytes += complete - t.complete[h]
+	t.complete[h] = complete
+	t.fn(t.progress)
+}
+
+func (t *progressTracker) layerDone(h v1.Hash) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.CompleteBytes += t.sizes[h] - t.complete[h]
+	t.complete[h] = t.sizes[h]
+	t.progress.CompleteLayers++
+	t.fn(t.progress)
+}
+
+func (t *progressTracker) report() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.fn(t.progress)
+}
+
+// scaled reports complete ratio of total over tracked layers size
+func (t *progressTracker) scaled(complete, total int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.CompleteBytes = t.progress.TotalBytes * complete / total
+	t.fn(t.progress)
+}
+
+// completed reports every tracked layer done
+func (t *progressTracker) completed() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.CompleteBytes = t.progress.TotalBytes
+	t.progress.CompleteLayers = t.progress.TotalLayers
+	t.fn(t.progress)
+}
@@ -2,10 +2,14 @@ package registry
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"net/http"
@@ -13,37 +17,76 @@ import (
 	"time"
 )
 
+// ErrTokenPullSecret reports token authenticated backup registries, kubelet can not pull with token credentials
+var ErrTokenPullSecret = errors.New("token credentials can not be used as pull secrets, username and password credentials are required")
+
 // DockerRegistry defines docker registry provider
 type DockerRegistry interface {
 	IsNonImageBackup(image string) bool
 	Exists(ctx context.Context, image string) (bool, error)
-	Backup(ctx context.Context, imageSource, imageDestination string) error
+	Backup(ctx context.Context, imageSource, imageDestination string, opts ...BackupOption) error
 	BackupImageName(image string) (string, error)
+	Digest(ctx context.Context, image string) (string, error)
+	Delete(ctx context.Context, image string) error
+	DockerConfigJSON() ([]byte, error)
 }
 
 type dockerRegistry struct {
 	backupRegistry string
 	credentials    authn.Authenticator
+	naming         NamingStrategy
+	platforms      []v1.Platform
+	artifacts      []string
+}
+
+// Option configures docker registry provider
+type Option func(*dockerRegistry)
+
+// WithNamingStrategy defines backup image naming strategy, legacy naming is used by default
+func WithNamingStrategy(n NamingStrategy) Option {
+	return func(d *dockerRegistry) {
+		d.naming = n
+	}
+}
+
+// WithAuthenticator defines backup registry authenticator, it overrides username and token credentials
+func WithAuthenticator(a authn.Authenticator) Option {
+	return func(d *dockerRegistry) {
+		d.credentials = a
+	}
 }
 
 // NewDockerRegistry instantiates docker registry provider
-func NewDockerRegistry(backupRepository, username, token string) DockerRegistry {
+func NewDockerRegistry(backupRepository, username, token string, opts ...Option) DockerRegistry {
 	auth := authn.AuthConfig{
 		Username: username,
 		Password: token,
 	}
 
-	return &dockerRegistry{
+	d := &dockerRegistry{
 		backupRegistry: backupRepository,
 		credentials:    authn.FromConfig(auth),
+		naming:         legacyNaming{},
+	}
+
+	for _, opt := range opts {
+		opt(d)
 	}
+
+	return d
 }
 
-// IsNonImageBackup checks if provided image is non image backup
+// IsNonImageBackup checks if provided image is non image backup, any image under backup registry
+// is recognized whatever naming strategy was used to create it
 func (d *dockerRegistry) IsNonImageBackup(image string) bool {
 	return !strings.HasPrefix(image, d.backupRegistry)
 }
 
+// prefix returns backup images name prefix
+func (d *dockerRegistry) prefix() string {
+	return d.backupRegistry
+}
+
 // Exists checks in docker register the image existence
 func (d *dockerRegistry) Exists(ctx context.Context, image string) (bool, error) {
 	startTs := time.Now()
@@ -57,38 +100,69 @@ func (d *dockerRegistry) Exists(ctx context.Context, image string) (bool, error)
 		return false, fmt.Errorf("unexpected parse image reference error %w", err)
 	}
 
-	_, err = remote.Index(ref, remote.WithContext(ctx), remote.WithAuth(d.credentials))
-	if err != nil {
-		e, ok := err.(*transport.Error)
-		if !ok {
-			existsErroredCalls.Inc()
-			return false, fmt.Errorf("unexpected get image %q error %w", ref, err)
-		}
+	auth := remote.WithAuthFromKeychain(d.keychain(ctx, image))
+	_, err = remote.Head(ref, remote.WithContext(ctx), auth)
+	if err == nil {
+		return true, nil
+	}
 
-		if e.StatusCode == http.StatusNotFound {
-			return false, nil
-		}
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	// some registries do not support manifest HEAD requests, fallback to GET whatever manifest media type
+	_, err = remote.Get(ref, remote.WithContext(ctx), auth)
+	if err == nil {
+		return true, nil
+	}
 
-		existsErroredCalls.Inc()
-		return false, fmt.Errorf("unexpected get image %q transport error %w", ref, err)
+	if isNotFound(err) {
+		return false, nil
 	}
 
-	return true, nil
+	existsErroredCalls.Inc()
+	return false, fmt.Errorf("unexpected get image %q error %w", ref, err)
+}
+
+func isNotFound(err error) bool {
+	var e *transport.Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
 }
 
 // Backup clones source image to backupRegistry destination
-func (d *dockerRegistry) Backup(ctx context.Context, imageSource, imageDestination string) error {
+func (d *dockerRegistry) Backup(ctx context.Context, imageSource, imageDestination string, opts ...BackupOption) error {
 	backupCalls.Inc()
 	startTs := time.Now()
 	defer func() {
 		backupDuration.Add(time.Since(startTs).Seconds())
 	}()
 
-	if err := crane.Copy(imageSource, imageDestination, crane.WithContext(ctx), crane.WithAuth(d.credentials)); err != nil {
+	o := &backupOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var err error
+	if _, ok := ctx.Value(sourceKeychainKey{}).(authn.Keychain); ok || o.progress != nil || len(d.platforms) > 0 {
+		err = d.copy(ctx, imageSource, imageDestination, o.progress)
+	} else {
+		err = crane.Copy(imageSource, imageDestination, crane.WithContext(ctx), crane.WithAuthFromKeychain(d.keychain(ctx, imageSource)))
+	}
+
+	if err != nil {
 		backupErroredCalls.Inc()
 		return fmt.Errorf("unexpected error copying image src %s dst %s, error %w", imageSource, imageDestination, err)
 	}
 
+	if len(d.artifacts) == 0 {
+		return nil
+	}
+
+	if err := d.copyArtifacts(ctx, imageSource, imageDestination, o.artifacts); err != nil {
+		backupErroredCalls.Inc()
+		return fmt.Errorf("unexpected error copying image src %s artifacts, error %w", imageSource, err)
+	}
+
 	return nil
 }
 
@@ -99,7 +173,94 @@ func (d *dockerRegistry) BackupImageName(image string) (string, error) {
 		return "", fmt.Errorf("unexpected parse image reference error %w", err)
 	}
 
-	replacedName := strings.ReplaceAll(ref.Context().RepositoryStr(), "/", "_")
+	repository := d.naming.Repository(d.backupRegistry, ref)
+	if _, ok := ref.(name.Digest); ok {
+		return fmt.Sprintf("%s@%s", repository, ref.Identifier()), nil
+	}
+
+	return fmt.Sprintf("%s:%s", repository, ref.Identifier()), nil
+}
+
+// Digest returns image manifest digest
+func (d *dockerRegistry) Digest(ctx context.Context, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	auth := remote.WithAuthFromKeychain(d.keychain(ctx, image))
+	desc, err := remote.Head(ref, remote.WithContext(ctx), auth)
+	if err == nil {
+		return desc.Digest.String(), nil
+	}
+
+	// some registries do not support manifest HEAD requests, fallback to GET
+	gd, err := remote.Get(ref, remote.WithContext(ctx), auth)
+	if err != nil {
+		return "", fmt.Errorf("unable to get image %q digest, error %w", ref, err)
+	}
+
+	return gd.Digest.String(), nil
+}
+
+// Delete removes image reference from registry, tags are deleted by tag so that other tags sharing its manifest
+// are kept, registries not supporting tag deletion return an error
+func (d *dockerRegistry) Delete(ctx context.Context, image string) error {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	if err := remote.Delete(ref, remote.WithContext(ctx), remote.WithAuth(d.credentials)); err != nil {
+		return fmt.Errorf("unable to delete image %q, error %w", ref, err)
+	}
+
+	return nil
+}
+
+// DockerConfigJSON returns backup registry credentials as dockerconfigjson pull secret data
+func (d *dockerRegistry) DockerConfigJSON() ([]byte, error) {
+	ref, err := name.ParseReference(d.backupRegistry + "pull-secret")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse backup registry %s, error %w", d.backupRegistry, err)
+	}
+
+	auth, err := d.credentials.Authorization()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get backup registry credentials, error %w", err)
+	}
+
+	// kubelet only reads username and password credentials, identity and registry tokens are ignored
+	if auth.Password == "" && (auth.IdentityToken != "" || auth.RegistryToken != "") {
+		return nil, fmt.Errorf("%w, backup registry %s", ErrTokenPullSecret, ref.Context().RegistryStr())
+	}
+
+	entry := dockerConfigEntry{
+		Username: auth.Username,
+		Password: auth.Password,
+	}
+	if auth.Username != "" || auth.Password != "" {
+		entry.Auth = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	}
+
+	return json.Marshal(dockerConfigJSON{Auths: map[string]dockerConfigEntry{ref.Context().RegistryStr(): entry}})
+}
+
+// PinnedImageName appends digest to image reference, digest references are returned as they are
+func PinnedImageName(image, digest string) string {
+	if digest == "" || strings.Contains(image, "@") {
+		return image
+	}
+
+	return image + "@" + digest
+}
+
+// SourceRegistry returns image registry host, unparseable images return an empty registry
+func SourceRegistry(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return ""
+	}
 
-	return fmt.Sprintf("%s%s:%s", d.backupRegistry, replacedName, ref.Identifier()), nil
+	return ref.Context().RegistryStr()
 }
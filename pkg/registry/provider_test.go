@@ -2,13 +2,20 @@ package registry
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	corev1 "k8s.io/api/core/v1"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -84,6 +91,42 @@ func TestDockerRegistryIsAbleToCreateBackupFromFakeImage(t *testing.T) {
 	}
 }
 
+func TestDockerRegistryReportsBackupProgress(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+	dst := fmt.Sprintf("%s/backupregistry/nginx:1.14.2", u.Host)
+
+	img, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	if err := crane.Push(img, src); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	var last Progress
+	r := NewDockerRegistry(u.Host+"/marcosquesada/", "marcosquesada", "fakeToken")
+	if err := r.Backup(context.Background(), src, dst, WithProgress(func(p Progress) { last = p })); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := 5, last.TotalLayers; expected != got {
+		t.Errorf("total layers do not match, expected %d got %d", expected, got)
+	}
+
+	if last.CompleteLayers != last.TotalLayers || last.CompleteBytes != last.TotalBytes || last.TotalBytes == 0 {
+		t.Errorf("backup not completed, progress %+v", last)
+	}
+
+	if _, err := crane.Digest(dst); err != nil {
+		t.Errorf("backup image not found, error %v", err)
+	}
+}
+
 func TestDockerRegistryIsAbleToCreateBackupFromNonPushedFakeImageReturnsError(t *testing.T) {
 	s := httptest.NewServer(registry.New())
 	defer s.Close()
@@ -100,7 +143,7 @@ func TestDockerRegistryIsAbleToCreateBackupFromNonPushedFakeImageReturnsError(t
 	}
 }
 
-func TestBackupImageNameGeneration(t *testing.T) {
+func TestLegacyBackupImageNameGeneration(t *testing.T) {
 	var testSamples = []struct {
 		registry string
 		image    string
@@ -124,7 +167,7 @@ func TestBackupImageNameGeneration(t *testing.T) {
 	}
 
 	for _, sample := range testSamples {
-		r := NewDockerRegistry(sample.registry, "bar", "zoom")
+		r := NewDockerRegistry(sample.registry, "bar", "zoom", WithNamingStrategy(legacyNaming{}))
 		res, err := r.BackupImageName(sample.image)
 		if err != nil {
 			t.Fatalf("unexpected error %v", err)
@@ -135,3 +178,136 @@ func TestBackupImageNameGeneration(t *testing.T) {
 		}
 	}
 }
+
+func TestDockerRegistryDigestMatchesPushedImage(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := fmt.Sprintf("%s/marcosquesada/nginx:1.14.2", u.Host)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("unable to create image, error %v", err)
+	}
+
+	if err := crane.Push(img, src); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	expected, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unable to get image digest, error %v", err)
+	}
+
+	r := NewDockerRegistry(u.Host+"/marcosquesada/", "fakeUser", "fakePassword")
+	got, err := r.Digest(context.Background(), src)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected.String() != got {
+		t.Fatalf("digest does not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestPinnedImageName(t *testing.T) {
+	digest := "sha256:0f1a4e1e8f8f0e7d4e52d4f5f8d0f58a4ebcf4ef1e3d2e5c4f8f4e8e3e4a5b6c"
+	if expected, got := "foo/nginx:1.21@"+digest, PinnedImageName("foo/nginx:1.21", digest); expected != got {
+		t.Errorf("values do not match, expected %s got %s", expected, got)
+	}
+
+	if expected, got := "foo/nginx@"+digest, PinnedImageName("foo/nginx@"+digest, digest); expected != got {
+		t.Errorf("values do not match, expected %s got %s", expected, got)
+	}
+}
+
+func TestDockerConfigJSONIsReadableAsPullSecret(t *testing.T) {
+	r := NewDockerRegistry("docker.io/backupregistry/", "backup", "token")
+	data, err := r.DockerConfigJSON()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	kc, err := NewPullSecretKeychain([]corev1.Secret{{
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: data},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ref, _ := name.ParseReference("docker.io/backupregistry/nginx:1.14.2")
+	a, _ := kc.Resolve(ref.Context())
+	cfg, err := a.Authorization()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if cfg.Username != "backup" || cfg.Password != "token" {
+		t.Errorf("credentials do not match, got %s/%s", cfg.Username, cfg.Password)
+	}
+}
+
+// kubeletCredentials decodes dockerconfigjson registry credentials as kubelet does, only username, password and
+// auth fields are read and auth overrides username and password
+func kubeletCredentials(t *testing.T, data []byte, registry string) (string, string) {
+	cfg := struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("unable to decode docker config, error %v", err)
+	}
+
+	e, ok := cfg.Auths[registry]
+	if !ok {
+		t.Fatalf("registry %s not found", registry)
+	}
+
+	if e.Auth == "" {
+		return e.Username, e.Password
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(e.Auth)
+	if err != nil {
+		t.Fatalf("unable to decode auth, error %v", err)
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		t.Fatalf("invalid auth %s", raw)
+	}
+
+	return parts[0], parts[1]
+}
+
+func TestDockerConfigJSONIsReadableByKubelet(t *testing.T) {
+	r := NewDockerRegistry("registry.example.com/backup/", "backup", "secret")
+	data, err := r.DockerConfigJSON()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	username, password := kubeletCredentials(t, data, "registry.example.com")
+	if username != "backup" || password != "secret" {
+		t.Errorf("credentials do not match, got %s/%s", username, password)
+	}
+}
+
+func TestDockerConfigJSONRejectsTokenCredentials(t *testing.T) {
+	var testSamples = []authn.AuthConfig{
+		{RegistryToken: "token"},
+		{Username: "backup", IdentityToken: "token"},
+	}
+
+	for _, sample := range testSamples {
+		r := NewDockerRegistry("registry.example.com/backup/", "", "", WithAuthenticator(authn.FromConfig(sample)))
+		if _, err := r.DockerConfigJSON(); !errors.Is(err, ErrTokenPullSecret) {
+			t.Errorf("expected token pull secret error on %+v, got %v", sample, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// SourceResolver resolves source image digests
+type SourceResolver interface {
+	Digest(ctx context.Context, image string) (string, error)
+}
+
+type remoteResolver struct {
+	keychain authn.Keychain
+}
+
+// NewSourceResolver instantiates a source image resolver, digests are resolved from source registries whatever
+// backup destination is configured. Keychain authenticates source requests along with context source keychain,
+// source registries are requested anonymously if empty
+func NewSourceResolver(kc authn.Keychain) SourceResolver {
+	if kc == nil {
+		kc = staticKeychain{auth: authn.Anonymous}
+	}
+
+	return remoteResolver{keychain: kc}
+}
+
+// Digest returns source image manifest digest, requests are authenticated from context source keychain or
+// resolver keychain
+func (r remoteResolver) Digest(ctx context.Context, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	kc := sourceKeychain(ctx, r.keychain)
+	auth := remote.WithAuthFromKeychain(kc)
+	desc, err := remote.Head(ref, remote.WithContext(ctx), auth)
+	if err == nil {
+		return desc.Digest.String(), nil
+	}
+
+	// some registries do not support manifest HEAD requests, fallback to GET
+	gd, err := remote.Get(ref, remote.WithContext(ctx), auth)
+	if err != nil {
+		return "", fmt.Errorf("unable to get image %q digest, error %w", ref, err)
+	}
+
+	return gd.Digest.String(), nil
+}
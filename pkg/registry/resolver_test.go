@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"context"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// privateRegistry serves a registry whose requests require foo:bar basic auth
+func privateRegistry() *httptest.Server {
+	reg := ggcrregistry.New()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if u, p, ok := req.BasicAuth(); !ok || u != "foo" || p != "bar" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		reg.ServeHTTP(w, req)
+	}))
+}
+
+func TestSourceResolverAuthenticatesWithBackupRegistryCredentials(t *testing.T) {
+	s := privateRegistry()
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	src := u.Host + "/backupaccount/private:v1"
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("unable to create random image, error %v", err)
+	}
+
+	backup := authn.FromConfig(authn.AuthConfig{Username: "foo", Password: "bar"})
+	if err := crane.Push(img, src, crane.WithAuth(backup)); err != nil {
+		t.Fatalf("unable to push image, error %v", err)
+	}
+
+	expected, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := NewSourceResolver(nil).Digest(context.Background(), src); err == nil {
+		t.Error("expected anonymous private image resolution error")
+	}
+
+	r := NewSourceResolver(NewRegistryKeychain(u.Host+"/backupaccount/", backup))
+	got, err := r.Digest(context.Background(), src)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected.String() != got {
+		t.Errorf("digest does not match, expected %s got %s", expected, got)
+	}
+
+	// backup credentials are never sent to other registry hosts
+	other := NewSourceResolver(NewRegistryKeychain("docker.io/backupaccount/", backup))
+	if _, err := other.Digest(context.Background(), src); err == nil {
+		t.Error("expected private image resolution error with credentials scoped to another host")
+	}
+
+	// context source keychain authenticates source requests too
+	ctx := WithSourceKeychain(context.Background(), staticKeychain{auth: authn.FromConfig(authn.AuthConfig{Username: "foo", Password: "bar"})})
+	if _, err := NewSourceResolver(nil).Digest(ctx, src); err != nil {
+		t.Errorf("unexpected error with source keychain %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/labels"
+	"path"
+	"regexp"
+	"sort"
+)
+
+// DefaultDestination is the default backup destination name
+const DefaultDestination = ""
+
+// Route selects a backup destination, empty matchers match any value
+type Route struct {
+	Destination string
+	// Namespaces are workload namespace glob patterns
+	Namespaces []string
+	// NamespaceSelector matches workload namespace labels
+	NamespaceSelector labels.Selector
+	// Images are source image glob patterns, as path.Match
+	Images []string
+	// ImageRegex matches source image
+	ImageRegex *regexp.Regexp
+}
+
+func (r Route) matches(namespace string, nsLabels map[string]string, image string) bool {
+	if len(r.Namespaces) > 0 && !matchAny(r.Namespaces, namespace) {
+		return false
+	}
+
+	if r.NamespaceSelector != nil && !r.NamespaceSelector.Matches(labels.Set(nsLabels)) {
+		return false
+	}
+
+	if len(r.Images) > 0 && !matchAny(r.Images, image) {
+		return false
+	}
+
+	return r.ImageRegex == nil || r.ImageRegex.MatchString(image)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Router routes backups to named destinations, each one with its own registry, credentials and naming strategy.
+// Router is a DockerRegistry whose backup image operations run on the destination owning the image, backup image
+// names are built by the default destination
+type Router interface {
+	DockerRegistry
+	// Route returns the destination of the first matching route, default destination if none matches
+	Route(namespace string, nsLabels map[string]string, image string) string
+	// Destination returns destination registry by name
+	Destination(name string) (DockerRegistry, bool)
+	// NamespaceLabelsRequired reports if any route matches namespace labels
+	NamespaceLabelsRequired() bool
+}
+
+type router struct {
+	destinations map[string]DockerRegistry
+	names        []string
+	routes       []Route
+}
+
+// NewRouter instantiates router, routes are evaluated in order
+func NewRouter(defaultRegistry DockerRegistry, destinations map[string]DockerRegistry, routes []Route) (Router, error) {
+	r := &router{
+		destinations: map[string]DockerRegistry{DefaultDestination: defaultRegistry},
+		names:        []string{DefaultDestination},
+		routes:       routes,
+	}
+
+	names := make([]string, 0, len(destinations))
+	for name, d := range destinations {
+		if name == DefaultDestination {
+			return nil, fmt.Errorf("empty destination name")
+		}
+		r.destinations[name] = d
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.names = append(r.names, names...)
+
+	for i, route := range routes {
+		if _, ok := r.destinations[route.Destination]; !ok {
+			return nil, fmt.Errorf("route %d destination %s not found", i, route.Destination)
+		}
+	}
+
+	return r, nil
+}
+
+// Route returns the destination of the first matching route, default destination if none matches
+func (r *router) Route(namespace string, nsLabels map[string]string, image string) string {
+	for _, route := range r.routes {
+		if route.matches(namespace, nsLabels, image) {
+			return route.Destination
+		}
+	}
+
+	return DefaultDestination
+}
+
+// Destination returns destination registry by name
+func (r *router) Destination(name string) (DockerRegistry, bool) {
+	d, ok := r.destinations[name]
+	return d, ok
+}
+
+// NamespaceLabelsRequired reports if any route matches namespace labels
+func (r *router) NamespaceLabelsRequired() bool {
+	for _, route := range r.routes {
+		if route.NamespaceSelector != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prefixed destinations report the backup image names prefix they own
+type prefixed interface {
+	prefix() string
+}
+
+// owner returns the destination owning backup image, default destination for non backup images. Destinations
+// whose prefixes are nested own the images matching the longest prefix
+func (r *router) owner(image string) DockerRegistry {
+	owner, length := r.destinations[DefaultDestination], -1
+	for _, name := range r.names {
+		d := r.destinations[name]
+		if d.IsNonImageBackup(image) {
+			continue
+		}
+
+		l := 0
+		if p, ok := d.(prefixed); ok {
+			l = len(p.prefix())
+		}
+
+		if l > length {
+			owner, length = d, l
+		}
+	}
+
+	return owner
+}
+
+// IsNonImageBackup checks image does not belong to any destination
+func (r *router) IsNonImageBackup(image string) bool {
+	for _, d := range r.destinations {
+		if !d.IsNonImageBackup(image) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Exists checks image existence on its destination
+func (r *router) Exists(ctx context.Context, image string) (bool, error) {
+	return r.owner(image).Exists(ctx, image)
+}
+
+// Backup clones source image to the destination owning backup image
+func (r *router) Backup(ctx context.Context, imageSource, imageDestination string, opts ...BackupOption) error {
+	return r.owner(imageDestination).Backup(ctx, imageSource, imageDestination, opts...)
+}
+
+// BackupImageName formats backup image name on default destination
+func (r *router) BackupImageName(image string) (string, error) {
+	return r.destinations[DefaultDestination].BackupImageName(image)
+}
+
+// Digest returns image manifest digest
+func (r *router) Digest(ctx context.Context, image string) (string, error) {
+	return r.owner(image).Digest(ctx, image)
+}
+
+// Delete removes image reference from its destination
+func (r *router) Delete(ctx context.Context, image string) error {
+	return r.owner(image).Delete(ctx, image)
+}
+
+// DockerConfigJSON merges all destinations credentials, so that workloads can pull from any destination
+func (r *router) DockerConfigJSON() ([]byte, error) {
+	merged := dockerConfigJSON{Auths: map[string]dockerConfigEntry{}}
+	for _, name := range r.names {
+		raw, err := r.destinations[name].DockerConfigJSON()
+		if err != nil {
+			return nil, fmt.Errorf("destination %s %w", name, err)
+		}
+
+		cfg := dockerConfigJSON{}
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse destination %s docker config, error %w", name, err)
+		}
+
+		for host, e := range cfg.Auths {
+			if _, ok := merged.Auths[host]; !ok {
+				merged.Auths[host] = e
+			}
+		}
+	}
+
+	return json.Marshal(merged)
+}
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"encoding/json"
+	"k8s.io/apimachinery/pkg/labels"
+	"regexp"
+	"testing"
+)
+
+func TestRouterSelectsFirstMatchingRouteDestination(t *testing.T) {
+	def := NewDockerRegistry("docker.io/backupregistry/", "foo", "bar")
+	eu := NewDockerRegistry("eu.gcr.io/backup/", "foo", "bar")
+	us := NewDockerRegistry("us.gcr.io/backup/", "foo", "bar")
+	r, err := NewRouter(def, map[string]DockerRegistry{"eu": eu, "us": us}, []Route{
+		{Destination: "eu", Namespaces: []string{"team-eu-*"}},
+		{Destination: "us", NamespaceSelector: labels.SelectorFromSet(labels.Set{"region": "us"})},
+		{Destination: "us", Images: []string{"ghcr.io/acme/*"}},
+		{Destination: "eu", ImageRegex: regexp.MustCompile(`^quay\.io/`)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var testSamples = []struct {
+		namespace string
+		labels    map[string]string
+		image     string
+		expected  string
+	}{
+		{namespace: "team-eu-a", image: "nginx:1.14.2", expected: "eu"},
+		{namespace: "default", labels: map[string]string{"region": "us"}, image: "nginx:1.14.2", expected: "us"},
+		{namespace: "default", image: "ghcr.io/acme/app:1.0.0", expected: "us"},
+		{namespace: "default", image: "ghcr.io/acme/team/app:1.0.0", expected: DefaultDestination},
+		{namespace: "default", image: "quay.io/foo/bar:1.0.0", expected: "eu"},
+		{namespace: "default", image: "nginx:1.14.2", expected: DefaultDestination},
+	}
+
+	for _, sample := range testSamples {
+		if expected, got := sample.expected, r.Route(sample.namespace, sample.labels, sample.image); expected != got {
+			t.Errorf("destination does not match on %s %s, expected %q got %q", sample.namespace, sample.image, expected, got)
+		}
+	}
+
+	if !r.NamespaceLabelsRequired() {
+		t.Error("expected namespace labels required")
+	}
+}
+
+func TestRouterRejectsRoutesToUnknownDestinations(t *testing.T) {
+	def := NewDockerRegistry("docker.io/backupregistry/", "foo", "bar")
+	if _, err := NewRouter(def, nil, []Route{{Destination: "eu"}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRouterDetectsBackupImagesFromAnyDestination(t *testing.T) {
+	def := NewDockerRegistry("docker.io/backupregistry/", "foo", "bar")
+	eu := NewDockerRegistry("eu.gcr.io/backup/", "foo", "bar")
+	r, err := NewRouter(def, map[string]DockerRegistry{"eu": eu}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if r.IsNonImageBackup("eu.gcr.io/backup/library_nginx:1.14.2") || r.IsNonImageBackup("docker.io/backupregistry/library_nginx:1.14.2") {
+		t.Error("expected backup image")
+	}
+
+	if !r.IsNonImageBackup("nginx:1.14.2") {
+		t.Error("expected non backup image")
+	}
+
+	data, err := r.DockerConfigJSON()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	cfg := dockerConfigJSON{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := 2, len(cfg.Auths); expected != got {
+		t.Errorf("auths size do not match, expected %d got %d", expected, got)
+	}
+}
+
+func TestRouterOwnerMatchesLongestDestinationPrefix(t *testing.T) {
+	def := NewDockerRegistry("docker.io/acme/", "foo", "bar")
+	team := NewDockerRegistry("docker.io/acme/team/", "team", "bar")
+	eu := NewDockerRegistry("eu.gcr.io/backup/", "foo", "bar")
+	r, err := NewRouter(def, map[string]DockerRegistry{"team": team, "eu": eu}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var testSamples = []struct {
+		image    string
+		expected DockerRegistry
+	}{
+		{image: "docker.io/acme/team/library_nginx:1.21", expected: team},
+		{image: "docker.io/acme/library_nginx:1.21", expected: def},
+		{image: "eu.gcr.io/backup/library_nginx:1.21", expected: eu},
+		{image: "nginx:1.21", expected: def},
+	}
+
+	for _, sample := range testSamples {
+		if got := r.(*router).owner(sample.image); got != sample.expected {
+			t.Errorf("image %s owner does not match, expected %s got %s", sample.image, sample.expected.(prefixed).prefix(), got.(prefixed).prefix())
+		}
+	}
+}
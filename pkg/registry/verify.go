@@ -0,0 +1,346 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers hashes used by signatures
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// ErrSignatureNotVerified reports images without any signature verified by configured public keys
+var ErrSignatureNotVerified = errors.New("signature not verified")
+
+const (
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	notationEnvelopeMediaType = "application/jose+json"
+)
+
+// Verifier verifies image signatures
+type Verifier interface {
+	Verify(ctx context.Context, image, digest string) error
+}
+
+type signatureVerifier struct {
+	keys []crypto.PublicKey
+}
+
+// NewSignatureVerifier instantiates an offline signature verifier, cosign key based signatures (tag conventions and
+// referrers) and notation JWS signatures are verified against public keys, transparency logs are not checked
+func NewSignatureVerifier(keys ...crypto.PublicKey) Verifier {
+	return &signatureVerifier{keys: keys}
+}
+
+// ParsePublicKeys parses PEM encoded public keys and certificates from Secret or ConfigMap data, keys are
+// returned sorted by data key
+func ParsePublicKeys(data map[string][]byte) ([]crypto.PublicKey, error) {
+	names := make([]string, 0, len(data))
+	for k := range data {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var keys []crypto.PublicKey
+	for _, n := range names {
+		rest := data[n]
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+
+			key, err := parsePublicKey(block)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s public key, error %w", n, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+
+	return keys, nil
+}
+
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+}
+
+// Verify checks image digest has at least one signature verified by any public key, source images are
+// fetched with source keychain or anonymously
+func (v *signatureVerifier) Verify(ctx context.Context, image, digest string) error {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return fmt.Errorf("unexpected parse image reference error %w", err)
+	}
+
+	repo := ref.Context()
+	auth := authn.Anonymous
+	if kc, ok := ctx.Value(sourceKeychainKey{}).(authn.Keychain); ok {
+		if auth, err = kc.Resolve(repo); err != nil {
+			return fmt.Errorf("unable to resolve source credentials, error %w", err)
+		}
+	}
+
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithAuth(auth)}
+	reason := "no signatures found"
+	verified, failure, err := v.verifyManifest(repo.Tag(digestTag(digest)+".sig"), digest, opts)
+	if err != nil || verified {
+		return err
+	}
+
+	if failure != "" {
+		reason = failure
+	}
+
+	idx, err := listReferrers(ctx, repo, auth, digest, opts)
+	if err != nil {
+		return fmt.Errorf("unable to list %s referrers, error %w", digest, err)
+	}
+
+	for _, r := range idx.Manifests {
+		if artifactKind(r.ArtifactType) != ArtifactSignature {
+			continue
+		}
+
+		verified, failure, err := v.verifyManifest(repo.Digest(r.Digest.String()), digest, opts)
+		if err != nil || verified {
+			return err
+		}
+
+		if failure != "" {
+			reason = failure
+		}
+	}
+
+	return fmt.Errorf("%w, image %s digest %s, %s", ErrSignatureNotVerified, image, digest, reason)
+}
+
+// verifyManifest verifies signature manifest layers reporting the verification failure, missing signature
+// manifests are not verified. Registry errors are returned so that verification can be retried
+func (v *signatureVerifier) verifyManifest(ref name.Reference, digest string, opts []remote.Option) (bool, string, error) {
+	img, err := remote.Image(ref, opts...)
+	if isNotFound(err) {
+		return false, "", nil
+	}
+
+	if err != nil {
+		return false, "", fmt.Errorf("unable to get signature %s, error %w", ref, err)
+	}
+
+	m, err := img.Manifest()
+	if err != nil {
+		return false, "", fmt.Errorf("unable to get signature %s manifest, error %w", ref, err)
+	}
+
+	failure := fmt.Sprintf("signature %s has no layers", ref)
+	for _, desc := range m.Layers {
+		payload, err := layerBlob(img, desc)
+		if err != nil {
+			return false, "", fmt.Errorf("unable to get signature %s layer, error %w", ref, err)
+		}
+
+		var verr error
+		switch {
+		case desc.MediaType == notationEnvelopeMediaType:
+			verr = v.verifyNotation(payload, digest)
+		case desc.Annotations[cosignSignatureAnnotation] != "":
+			verr = v.verifyCosign(payload, desc.Annotations[cosignSignatureAnnotation], digest)
+		default:
+			verr = fmt.Errorf("unsupported signature layer %s", desc.MediaType)
+		}
+
+		if verr == nil {
+			return true, "", nil
+		}
+		failure = verr.Error()
+	}
+
+	return false, failure, nil
+}
+
+func layerBlob(img v1.Image, desc v1.Descriptor) ([]byte, error) {
+	l, err := img.LayerByDigest(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// verifyCosign verifies cosign simple signing payload signature and its signed manifest digest
+func (v *signatureVerifier) verifyCosign(payload []byte, signature, digest string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid cosign signature encoding, error %w", err)
+	}
+
+	if !v.verifyAny(payload, sig, crypto.SHA256, false) {
+		return errors.New("cosign signature does not match any public key")
+	}
+
+	p := struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}{}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("invalid cosign payload, error %w", err)
+	}
+
+	if p.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("cosign signature signs digest %s", p.Critical.Image.DockerManifestDigest)
+	}
+
+	return nil
+}
+
+// verifyNotation verifies notation JWS envelope signature and its target artifact digest
+func (v *signatureVerifier) verifyNotation(envelope []byte, digest string) error {
+	e := struct {
+		Payload   string `json:"payload"`
+		Protected string `json:"protected"`
+		Signature string `json:"signature"`
+	}{}
+	if err := json.Unmarshal(envelope, &e); err != nil {
+		return fmt.Errorf("invalid notation envelope, error %w", err)
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(e.Protected)
+	if err != nil {
+		return fmt.Errorf("invalid notation protected header, error %w", err)
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return fmt.Errorf("invalid notation protected header, error %w", err)
+	}
+
+	hash, pss, err := jwsAlgorithm(header.Alg)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(e.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid notation signature encoding, error %w", err)
+	}
+
+	if !v.verifyAny([]byte(e.Protected+"."+e.Payload), sig, hash, pss) {
+		return errors.New("notation signature does not match any public key")
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid notation payload, error %w", err)
+	}
+
+	p := struct {
+		TargetArtifact v1.Descriptor `json:"targetArtifact"`
+	}{}
+	if err := json.Unmarshal(rawPayload, &p); err != nil {
+		return fmt.Errorf("invalid notation payload, error %w", err)
+	}
+
+	if p.TargetArtifact.Digest.String() != digest {
+		return fmt.Errorf("notation signature signs digest %s", p.TargetArtifact.Digest)
+	}
+
+	return nil
+}
+
+// jwsAlgorithm returns JWS algorithm hash and if RSA signatures use PSS padding
+func jwsAlgorithm(alg string) (crypto.Hash, bool, error) {
+	switch alg {
+	case "PS256", "ES256":
+		return crypto.SHA256, strings.HasPrefix(alg, "PS"), nil
+	case "PS384", "ES384":
+		return crypto.SHA384, strings.HasPrefix(alg, "PS"), nil
+	case "PS512", "ES512":
+		return crypto.SHA512, strings.HasPrefix(alg, "PS"), nil
+	}
+
+	return 0, false, fmt.Errorf("unsupported notation signature algorithm %s", alg)
+}
+
+// verifyAny checks signature against every public key, ECDSA signatures are accepted both ASN.1 and JWS r||s encoded
+func (v *signatureVerifier) verifyAny(payload, sig []byte, hash crypto.Hash, pss bool) bool {
+	h := hash.New()
+	h.Write(payload)
+	sum := h.Sum(nil)
+
+	for _, key := range v.keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, sum, sig) {
+				return true
+			}
+
+			if len(sig)%2 == 0 {
+				r, s := new(big.Int).SetBytes(sig[:len(sig)/2]), new(big.Int).SetBytes(sig[len(sig)/2:])
+				if ecdsa.Verify(k, sum, r, s) {
+					return true
+				}
+			}
+		case *rsa.PublicKey:
+			if pss {
+				if rsa.VerifyPSS(k, hash, sum, sig, nil) == nil {
+					return true
+				}
+				continue
+			}
+
+			if rsa.VerifyPKCS1v15(k, hash, sum, sig) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, payload, sig) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
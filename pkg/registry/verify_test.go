@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSignatureVerifierVerifiesCosignSignatures(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	signed := u.Host + "/marcosquesada/nginx:1.14.2"
+	unsigned := u.Host + "/marcosquesada/nginx:1.15.0"
+	digest := pushRandomImage(t, signed)
+	unsignedDigest := pushRandomImage(t, unsigned)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key, error %v", err)
+	}
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, signed, digest))
+	sum := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatalf("unable to sign payload, error %v", err)
+	}
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, "application/vnd.dev.cosign.simplesigning.v1+json"),
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ref, _ := name.ParseReference(u.Host + "/marcosquesada/nginx:" + strings.Replace(digest.String(), ":", "-", 1) + ".sig")
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("unable to push signature, error %v", err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var testSamples = []struct {
+		image    string
+		digest   string
+		key      crypto.PublicKey
+		verified bool
+	}{
+		{image: signed, digest: digest.String(), key: key.Public(), verified: true},
+		{image: signed, digest: digest.String(), key: other.Public(), verified: false},
+		{image: unsigned, digest: unsignedDigest.String(), key: key.Public(), verified: false},
+	}
+
+	for i, sample := range testSamples {
+		err := NewSignatureVerifier(sample.key).Verify(context.Background(), sample.image, sample.digest)
+		if sample.verified && err != nil {
+			t.Errorf("sample %d unexpected error %v", i, err)
+		}
+
+		if !sample.verified && !errors.Is(err, ErrSignatureNotVerified) {
+			t.Errorf("sample %d expected signature not verified error, got %v", i, err)
+		}
+	}
+}
+
+func TestSignatureVerifierVerifiesNotationReferrers(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	image := u.Host + "/marcosquesada/nginx:1.14.2"
+	digest := pushRandomImage(t, image)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key, error %v", err)
+	}
+
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"PS256","cty":"application/vnd.cncf.notary.payload.v1+json"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"targetArtifact":{"mediaType":"%s","digest":"%s","size":1}}`, types.DockerManifestSchema2, digest)))
+	sum := sha256.Sum256([]byte(protected + "." + payload))
+	sig, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, sum[:], nil)
+	if err != nil {
+		t.Fatalf("unable to sign payload, error %v", err)
+	}
+
+	envelope, _ := json.Marshal(map[string]string{"payload": payload, "protected": protected, "signature": base64.RawURLEncoding.EncodeToString(sig)})
+	img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: static.NewLayer(envelope, notationEnvelopeMediaType)})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	sigDigest, _ := img.Digest()
+	repo, _ := name.NewRepository(u.Host + "/marcosquesada/nginx")
+	if err := remote.Write(repo.Digest(sigDigest.String()), img); err != nil {
+		t.Fatalf("unable to push signature, error %v", err)
+	}
+
+	raw, _ := json.Marshal(referrersIndex{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests:     []referrer{{MediaType: types.DockerManifestSchema2, Digest: sigDigest, ArtifactType: "application/vnd.cncf.notary.signature"}},
+	})
+	if err := remote.Put(repo.Tag(digestTag(digest.String())), rawManifest{raw: raw, mediaType: types.OCIImageIndex}); err != nil {
+		t.Fatalf("unable to push referrers tag, error %v", err)
+	}
+
+	if err := NewSignatureVerifier(key.Public()).Verify(context.Background(), image, digest.String()); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestParsePublicKeysFromPEMData(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	keys, err := ParsePublicKeys(map[string][]byte{"cosign.pub": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected, got := 1, len(keys); expected != got {
+		t.Errorf("keys do not match, expected %d got %d", expected, got)
+	}
+
+	if _, err := ParsePublicKeys(map[string][]byte{"README": []byte("no keys")}); err == nil {
+		t.Error("expected error")
+	}
+}